@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// adminCommands holds the names of the local commands only admins can run, in lowercase
+var adminCommands = map[string]bool{}
+
+// registerAdminCommand adds a locally handled command that only admins can run, features call this from init().
+func registerAdminCommand(name string, fn commandFunc) {
+	registerCommand(name, fn)
+	adminCommands[strings.ToLower(name)] = true
+}
+
+// isAdminCommand reports whether a command is restricted to admins, either a local admin command
+// or one of the backend commands configured as admin only.
+func isAdminCommand(config *Config, command string) bool {
+	if adminCommands[strings.ToLower(command)] {
+		return true
+	}
+	for _, name := range config.CommandBackend.AdminOnly {
+		if strings.EqualFold(name, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdmin reports whether the source of a message, nick!user@host, matches one of the admin hostmasks.
+func isAdmin(config *Config, source string) bool {
+	for _, pattern := range config.Admins {
+		if hostmaskMatches(pattern, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostmaskMatches reports whether a hostmask matches a pattern where * matches any number of characters
+// and ? a single one, case-insensitively. Unlike path.Match, * also matches the / in cloaks like user/nick.
+func hostmaskMatches(pattern, hostmask string) bool {
+	var expr strings.Builder
+	expr.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	matched, err := regexp.MatchString(expr.String(), hostmask)
+	return err == nil && matched
+}
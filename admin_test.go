@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestHostmaskMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		hostmask string
+		want     bool
+	}{
+		{name: "exact", pattern: "nick!user@host.example", hostmask: "nick!user@host.example", want: true},
+		{name: "case-insensitive", pattern: "Nick!User@Host.Example", hostmask: "nick!user@host.example", want: true},
+		{name: "star matches anything", pattern: "*!*@host.example", hostmask: "nick!user@host.example", want: true},
+		{name: "star matches nothing", pattern: "nick*!user@host.example", hostmask: "nick!user@host.example", want: true},
+		{name: "star matches a cloak", pattern: "*!*@user/*", hostmask: "nick!~nick@user/nick/bot", want: true},
+		{name: "question mark matches one", pattern: "nic?!user@host.example", hostmask: "nick!user@host.example", want: true},
+		{name: "question mark needs a character", pattern: "nick?!user@host.example", hostmask: "nick!user@host.example", want: false},
+		{name: "other host", pattern: "*!*@host.example", hostmask: "nick!user@evil.example", want: false},
+		{name: "dots are literal", pattern: "*!*@host.example", hostmask: "nick!user@hostXexample", want: false},
+		{name: "anchored", pattern: "nick!user@host", hostmask: "nick!user@host.example", want: false},
+		{name: "regexp characters are literal", pattern: "n[i]ck!*@*", hostmask: "nick!user@host", want: false},
+		{name: "empty pattern", pattern: "", hostmask: "nick!user@host", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostmaskMatches(tt.pattern, tt.hostmask); got != tt.want {
+				t.Errorf("hostmaskMatches(%q, %q) = %v, want %v", tt.pattern, tt.hostmask, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	config := &Config{Admins: []string{"owner!*@*", "*!*@staff/*"}}
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{source: "owner!~owner@198.51.100.7", want: true},
+		{source: "helper!helper@staff/helper", want: true},
+		{source: "someone!someone@198.51.100.7", want: false},
+		{source: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := isAdmin(config, tt.source); got != tt.want {
+				t.Errorf("isAdmin(%q) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+
+	if isAdmin(&Config{}, "owner!~owner@198.51.100.7") {
+		t.Error("isAdmin() without admins = true, want false")
+	}
+}
+
+func TestIsAdminCommand(t *testing.T) {
+	config := &Config{CommandBackend: CommandConfig{AdminOnly: []string{"Deploy"}}}
+
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{command: "say", want: true},
+		{command: "SAY", want: true},
+		{command: "deploy", want: true},
+		{command: "weather", want: false},
+		{command: "help", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := isAdminCommand(config, tt.command); got != tt.want {
+				t.Errorf("isAdminCommand(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
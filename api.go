@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxResponseSize is the largest response body accepted from an API by default
+	defaultMaxResponseSize = 1 << 20
+	// debugBodyLength is how much of a response body is logged in debug mode
+	debugBodyLength = 500
+	// errorBodyLength is how much of the body of an error response is included in the error
+	errorBodyLength = 200
+	// defaultAPITimeout is how long a request may take by default, reading the response included
+	defaultAPITimeout = 10 * time.Second
+)
+
+const (
+	// maxAPIAttempts is how many times a request that failed for a transient reason is made in total
+	maxAPIAttempts = 3
+	// apiRetryBackoff is the wait before the first retry, doubled for every retry after it
+	apiRetryBackoff = 250 * time.Millisecond
+)
+
+// errAPITimeout is returned when an API doesn't answer in time
+var errAPITimeout = errors.New("API request timed out")
+
+// apiStatusError is returned when an API answers with a status other than 2xx.
+type apiStatusError struct {
+	StatusCode int
+	Status     string
+	// The start of the response body, error pages usually say what went wrong
+	Body string
+}
+
+func (e *apiStatusError) Error() string {
+	if e.Body == "" {
+		return "API returned " + e.Status
+	}
+	return fmt.Sprintf("API returned %s: %s", e.Status, e.Body)
+}
+
+// isRetryable reports whether a request could succeed if it's made again: the connection failed
+// or a gateway in front of the API was unavailable, e.g. while a Lambda function cold starts.
+// Timeouts are not retried, the API already had its chance, and neither are errors that would
+// only happen again, like bad URLs or failed TLS handshakes.
+func isRetryable(err error) (retryable bool, statusCode int) {
+	var statusErr *apiStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, statusErr.StatusCode
+		}
+		return false, statusErr.StatusCode
+	}
+	if errors.Is(err, errAPITimeout) {
+		return false, 0
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true, 0
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF), 0
+}
+
+// apiClient is shared by all API calls so that connections to the backends are kept alive and reused.
+// http.Client is safe for concurrent use, the timeout of each API is set on the request context instead.
+var apiClient = &http.Client{Transport: newAPITransport()}
+
+// newAPITransport returns the default transport tuned for many small requests to a few hosts.
+func newAPITransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 10
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+// sensitiveHeaders are never logged in debug mode
+var sensitiveHeaders = []string{"Authorization", "X-Api-Key", "Cookie"}
+
+// callAPI sends payload to the API endpoint and decodes the JSON response into response.
+// The payload is sent as a JSON body, or as query parameters for GET endpoints.
+// Endpoints that keep failing are not called again until their circuit breaker lets a trial request through.
+func callAPI(api APIConfig, payload any, response any) error {
+	breaker := breakerFor(api)
+	if !breaker.allow() {
+		return fmt.Errorf("%w for %s", errCircuitOpen, redactSecrets(api, api.Endpoint))
+	}
+
+	err := requestWithRetry(api, payload, response)
+	// An API that answered, even with an error about the request, is up
+	if err != nil && isBackendFailure(err) {
+		if breaker.failure() {
+			slog.Warn("API keeps failing, pausing requests", "endpoint", redactSecrets(api, api.Endpoint), "error", err)
+		}
+		return err
+	}
+	breaker.success()
+	return err
+}
+
+// isBackendFailure reports whether an error means the API itself is in trouble: it couldn't be reached,
+// didn't answer in time or answered with a 5xx status. Rejected requests and unexpected responses are not.
+func isBackendFailure(err error) bool {
+	var statusErr *apiStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return isUnreachable(err) || errors.Is(err, errAPITimeout)
+}
+
+// requestWithRetry makes the request, retrying it with backoff while it fails for a transient reason.
+func requestWithRetry(api APIConfig, payload any, response any) error {
+	backoff := apiRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := requestAPI(api, payload, response)
+		if err == nil {
+			return nil
+		}
+		retryable, statusCode := isRetryable(err)
+		if !retryable {
+			return err
+		}
+		if attempt >= maxAPIAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		slog.Debug("API request failed, retrying", "endpoint", redactSecrets(api, api.Endpoint), "attempt", attempt, "status", statusCode, "error", err)
+		<-defaultClock.After(backoff)
+		backoff *= 2
+	}
+}
+
+// apiTimeout returns how long a request to the API may take.
+func apiTimeout(api APIConfig) time.Duration {
+	if api.Timeout <= 0 {
+		return defaultAPITimeout
+	}
+	return time.Duration(api.Timeout)
+}
+
+// wrapTimeout marks errors caused by the request deadline with errAPITimeout, keeping the original error.
+func wrapTimeout(err error, timeout time.Duration) error {
+	var netErr interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w after %s: %w", errAPITimeout, timeout, err)
+	}
+	return err
+}
+
+// requestAPI makes a single request to the API, cancelling it if it takes longer than the timeout of the API.
+func requestAPI(api APIConfig, payload any, response any) error {
+	timeout := apiTimeout(api)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := newAPIRequest(ctx, api, payload)
+	if err != nil {
+		return fmt.Errorf("error constructing request: %w", err)
+	}
+	setAuth(req, api)
+	for name, value := range api.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if api.Debug {
+		logRequest(api, req)
+	}
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return wrapTimeout(fmt.Errorf("error doing request: %w", err), timeout)
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit to tell a body of exactly the maximum size from a larger one
+	maxSize := api.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxResponseSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return wrapTimeout(fmt.Errorf("error reading response body: %w", err), timeout)
+	}
+
+	if api.Debug {
+		slog.Info("API response", "endpoint", redactSecrets(api, api.Endpoint), "status", resp.Status, "body", redactSecrets(api, truncate(string(body), debugBodyLength)))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Keep the snippet on one line, error pages are mostly markup and whitespace
+		snippet := strings.Join(strings.Fields(redactSecrets(api, string(body))), " ")
+		return &apiStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: truncate(snippet, errorBodyLength)}
+	}
+
+	// Gateways and proxies answer with HTML error pages, catch those before trying to decode them
+	if err := checkJSONContentType(resp.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	if int64(len(body)) > maxSize {
+		return fmt.Errorf("response body exceeds maximum size of %d bytes", maxSize)
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	return nil
+}
+
+// checkJSONContentType returns an error unless the content type is JSON.
+func checkJSONContentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid response content type %q: %w", contentType, err)
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return fmt.Errorf("expected a JSON response, got content type %q", mediaType)
+	}
+	return nil
+}
+
+// newAPIRequest builds the HTTP request for a payload using the method of the API.
+func newAPIRequest(ctx context.Context, api APIConfig, payload any) (*http.Request, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(api.Method, http.MethodGet) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, api.Endpoint, bytes.NewBuffer(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	// Use the JSON field names of the payload as query parameter names
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	for name, value := range fields {
+		query.Set(name, fmt.Sprint(value))
+	}
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+// setAuth adds the API key to the request the way the backend expects it.
+func setAuth(req *http.Request, api APIConfig) {
+	switch strings.ToLower(api.AuthType) {
+	case "none":
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+api.APIKey)
+	case "header":
+		req.Header.Set(api.AuthHeader, api.APIKey)
+	default:
+		// The AWS API Gateway style
+		req.Header.Set("x-api-key", api.APIKey)
+	}
+}
+
+// isUnreachable reports whether the error means the API couldn't be reached at all,
+// as opposed to the API answering with an error.
+func isUnreachable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, errCircuitOpen)
+}
+
+// logRequest logs an outgoing API request with its secrets redacted.
+func logRequest(api APIConfig, req *http.Request) {
+	headers := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		value := req.Header.Get(name)
+		if isSensitiveHeader(api, name) {
+			value = "[REDACTED]"
+		}
+		headers = append(headers, name+": "+redactSecrets(api, value))
+	}
+	sort.Strings(headers)
+
+	var body []byte
+	if req.GetBody != nil {
+		if reader, err := req.GetBody(); err == nil {
+			body, _ = io.ReadAll(reader)
+		}
+	}
+
+	slog.Info("API request", "method", req.Method, "url", redactSecrets(api, req.URL.Redacted()), "headers", strings.Join(headers, ", "), "body", redactSecrets(api, string(body)))
+}
+
+// isSensitiveHeader reports whether a header carries credentials, so its value must not be logged.
+func isSensitiveHeader(api APIConfig, name string) bool {
+	for _, sensitive := range append(sensitiveHeaders, api.AuthHeader) {
+		if sensitive != "" && strings.EqualFold(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets replaces the API key and the values of sensitive custom headers wherever they appear in s.
+// Other header values, e.g. Accept: application/json, are left alone.
+func redactSecrets(api APIConfig, s string) string {
+	secrets := []string{api.APIKey}
+	for name, value := range api.Headers {
+		if isSensitiveHeader(api, name) {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "[REDACTED]")
+		}
+	}
+	return s
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
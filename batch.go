@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	wantCap("batch")
+
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		batches.reset(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		batches.reset(conn)
+	})
+
+	registerFeature("batch", func(config *Config, conn *irc.Connection) {
+		// BATCH "+<reference> <type> [<params>...]" starts a batch and "-<reference>" ends it
+		conn.AddCallback("BATCH", func(e *irc.Event) {
+			handleBatch(config, conn, e)
+		})
+		conn.AddCallback("*", func(e *irc.Event) {
+			batches.collect(conn, e)
+		})
+	})
+}
+
+// ircBatch is a group of related messages the server sent together, e.g. the quits of a netsplit.
+type ircBatch struct {
+	Ref    string
+	Type   string
+	Params []string
+	// The messages of the batch in the order they arrived
+	Events []*irc.Event
+}
+
+// batchHandler receives a batch once all of its messages have arrived.
+type batchHandler func(config *Config, conn *irc.Connection, batch *ircBatch)
+
+var (
+	batchHandlersMutex sync.Mutex
+	// batch type -> handlers
+	batchHandlers = map[string][]batchHandler{}
+)
+
+// batchStore keeps the batches that are still open on each connection.
+type batchStore struct {
+	sync.Mutex
+	// connection -> reference -> batch
+	open map[*irc.Connection]map[string]*ircBatch
+}
+
+var batches = &batchStore{open: make(map[*irc.Connection]map[string]*ircBatch)}
+
+// onBatch registers a handler for completed batches of a type, features call this from init().
+func onBatch(batchType string, handler batchHandler) {
+	batchHandlersMutex.Lock()
+	defer batchHandlersMutex.Unlock()
+	batchType = strings.ToLower(batchType)
+	batchHandlers[batchType] = append(batchHandlers[batchType], handler)
+}
+
+// batchOf returns the open batch a message belongs to, nil if it isn't part of one.
+func batchOf(conn *irc.Connection, e *irc.Event) *ircBatch {
+	ref, ok := e.Tags["batch"]
+	if !ok {
+		return nil
+	}
+	batches.Lock()
+	defer batches.Unlock()
+	return batches.open[conn][ref]
+}
+
+func (s *batchStore) reset(conn *irc.Connection) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.open, conn)
+}
+
+func (s *batchStore) start(conn *irc.Connection, batch *ircBatch) {
+	s.Lock()
+	defer s.Unlock()
+	if s.open[conn] == nil {
+		s.open[conn] = make(map[string]*ircBatch)
+	}
+	s.open[conn][batch.Ref] = batch
+}
+
+// end closes a batch and returns it, nil if it wasn't open.
+func (s *batchStore) end(conn *irc.Connection, ref string) *ircBatch {
+	s.Lock()
+	defer s.Unlock()
+	batch := s.open[conn][ref]
+	delete(s.open[conn], ref)
+	return batch
+}
+
+// collect adds a message to the batch it is tagged with.
+func (s *batchStore) collect(conn *irc.Connection, e *irc.Event) {
+	ref, ok := e.Tags["batch"]
+	if !ok || e.Code == "BATCH" {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if batch, ok := s.open[conn][ref]; ok {
+		batch.Events = append(batch.Events, e)
+	}
+}
+
+// handleBatch opens and closes batches, passing completed ones to the handlers of their type.
+func handleBatch(config *Config, conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) == 0 || len(e.Arguments[0]) < 2 {
+		return
+	}
+	ref := e.Arguments[0][1:]
+
+	switch e.Arguments[0][0] {
+	case '+':
+		if len(e.Arguments) < 2 {
+			return
+		}
+		batches.start(conn, &ircBatch{Ref: ref, Type: strings.ToLower(e.Arguments[1]), Params: e.Arguments[2:]})
+	case '-':
+		batch := batches.end(conn, ref)
+		if batch == nil {
+			return
+		}
+		batchHandlersMutex.Lock()
+		handlers := append([]batchHandler{}, batchHandlers[batch.Type]...)
+		batchHandlersMutex.Unlock()
+		for _, handler := range handlers {
+			handler(config, conn, batch)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// useBatchHandlers replaces the registered batch handlers for the duration of the test.
+func useBatchHandlers(t *testing.T) {
+	t.Helper()
+	batchHandlersMutex.Lock()
+	saved := batchHandlers
+	batchHandlers = map[string][]batchHandler{}
+	batchHandlersMutex.Unlock()
+	t.Cleanup(func() {
+		batchHandlersMutex.Lock()
+		batchHandlers = saved
+		batchHandlersMutex.Unlock()
+	})
+}
+
+func TestBatchGrouping(t *testing.T) {
+	useBatchHandlers(t)
+
+	var completed []*ircBatch
+	onBatch("NETSPLIT", func(config *Config, conn *irc.Connection, batch *ircBatch) {
+		completed = append(completed, batch)
+	})
+
+	conn := irc.IRC("gobot", "gobot")
+	t.Cleanup(func() { batches.reset(conn) })
+	for _, f := range features {
+		if f.name == "batch" {
+			f.setup(&Config{}, conn)
+		}
+	}
+
+	quit := func(nick, ref string) *irc.Event {
+		e := &irc.Event{Code: "QUIT", Nick: nick, Arguments: []string{"a.net b.net"}}
+		if ref != "" {
+			e.Tags = map[string]string{"batch": ref}
+		}
+		return e
+	}
+	events := []*irc.Event{
+		{Code: "BATCH", Arguments: []string{"+yXNAbvnRHTRBv", "netsplit", "a.net", "b.net"}},
+		quit("alice", "yXNAbvnRHTRBv"),
+		quit("outside", ""),
+		quit("unknown", "other"),
+		quit("bob", "yXNAbvnRHTRBv"),
+	}
+	for _, e := range events {
+		conn.RunCallbacks(e)
+	}
+
+	if batch := batchOf(conn, events[1]); batch == nil || batch.Type != "netsplit" {
+		t.Errorf("batchOf() of a batched message = %+v, want the netsplit batch", batch)
+	}
+	if batch := batchOf(conn, events[2]); batch != nil {
+		t.Errorf("batchOf() of a message outside the batch = %+v, want nil", batch)
+	}
+	if len(completed) != 0 {
+		t.Fatal("batch was handled before it ended")
+	}
+
+	conn.RunCallbacks(&irc.Event{Code: "BATCH", Arguments: []string{"-yXNAbvnRHTRBv"}})
+	if len(completed) != 1 {
+		t.Fatalf("handled %d batches, want 1", len(completed))
+	}
+	batch := completed[0]
+	if !slices.Equal(batch.Params, []string{"a.net", "b.net"}) {
+		t.Errorf("params = %q, want [a.net b.net]", batch.Params)
+	}
+	var nicks []string
+	for _, e := range batch.Events {
+		nicks = append(nicks, e.Nick)
+	}
+	if !slices.Equal(nicks, []string{"alice", "bob"}) {
+		t.Errorf("batch messages are from %q, want [alice bob]", nicks)
+	}
+	if batchOf(conn, events[1]) != nil {
+		t.Error("batch is still open after it ended")
+	}
+
+	// Ending a batch that isn't open does nothing
+	conn.RunCallbacks(&irc.Event{Code: "BATCH", Arguments: []string{"-yXNAbvnRHTRBv"}})
+	if len(completed) != 1 {
+		t.Errorf("handled %d batches, want 1", len(completed))
+	}
+}
+
+func TestHandleBatchOtherTypes(t *testing.T) {
+	useBatchHandlers(t)
+	handled := false
+	onBatch("netsplit", func(config *Config, conn *irc.Connection, batch *ircBatch) {
+		handled = true
+	})
+
+	conn := irc.IRC("gobot", "gobot")
+	t.Cleanup(func() { batches.reset(conn) })
+	for _, args := range [][]string{
+		{"+1", "chathistory", "#go"},
+		{"-1"},
+		{"+"},
+		{"+2"},
+		{},
+	} {
+		handleBatch(&Config{}, conn, &irc.Event{Code: "BATCH", Arguments: args})
+	}
+	if handled {
+		t.Error("netsplit handler got a batch of another type")
+	}
+}
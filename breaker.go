@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerThreshold is how many consecutive failures open the circuit by default
+	defaultBreakerThreshold = 5
+	// defaultBreakerCooldown is how long an open circuit fails fast by default
+	defaultBreakerCooldown = time.Minute
+)
+
+// errCircuitOpen is returned instead of calling a backend that has been failing
+var errCircuitOpen = errors.New("circuit breaker open")
+
+type breakerState int
+
+const (
+	// breakerClosed lets requests through and counts failures
+	breakerClosed breakerState = iota
+	// breakerOpen fails every request until the cooldown is over
+	breakerOpen
+	// breakerHalfOpen lets a single trial request through to see if the backend is back
+	breakerHalfOpen
+)
+
+// circuitBreaker stops calls to a backend for a while after it fails repeatedly.
+type circuitBreaker struct {
+	sync.Mutex
+	clock     Clock
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{clock: defaultClock, threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may be made. After the cooldown one trial request is let through.
+func (b *circuitBreaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// The trial request is still in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// success closes the circuit.
+func (b *circuitBreaker) success() {
+	b.Lock()
+	defer b.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// failure counts a failed request, opening the circuit at the threshold or if the trial request failed.
+// It reports whether the circuit was opened.
+func (b *circuitBreaker) failure() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = b.clock.Now()
+		return true
+	}
+	return false
+}
+
+// breakerKey identifies a circuit breaker, endpoints configured with different settings get breakers of their own
+type breakerKey struct {
+	endpoint  string
+	threshold int
+	cooldown  time.Duration
+}
+
+var (
+	breakersMutex sync.Mutex
+	// breakers holds a circuit breaker per endpoint and settings
+	breakers = map[breakerKey]*circuitBreaker{}
+)
+
+// breakerFor returns the circuit breaker of an API endpoint.
+func breakerFor(api APIConfig) *circuitBreaker {
+	key := breakerKey{endpoint: api.Endpoint, threshold: api.BreakerThreshold, cooldown: time.Duration(api.BreakerCooldown)}
+	if key.threshold <= 0 {
+		key.threshold = defaultBreakerThreshold
+	}
+	if key.cooldown <= 0 {
+		key.cooldown = defaultBreakerCooldown
+	}
+
+	breakersMutex.Lock()
+	defer breakersMutex.Unlock()
+	breaker, ok := breakers[key]
+	if !ok {
+		breaker = newCircuitBreaker(key.threshold, key.cooldown)
+		breakers[key] = breaker
+	}
+	return breaker
+}
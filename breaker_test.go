@@ -0,0 +1,178 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock only moves when the test advances it.
+type manualClock struct {
+	now time.Time
+
+	timersMutex sync.Mutex
+	timers      []*manualTimer
+}
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// AfterFunc schedules f, which advance calls once the clock has reached its time.
+func (c *manualClock) AfterFunc(d time.Duration, f func()) Timer {
+	timer := &manualTimer{clock: c, f: f}
+	timer.Reset(d)
+	return timer
+}
+
+// advance moves the clock forward and calls the functions that became due in the test's goroutine.
+func (c *manualClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	for {
+		c.timersMutex.Lock()
+		var due *manualTimer
+		for _, timer := range c.timers {
+			if timer.pending && !timer.at.After(c.now) && (due == nil || timer.at.Before(due.at)) {
+				due = timer
+			}
+		}
+		if due != nil {
+			due.pending = false
+		}
+		c.timersMutex.Unlock()
+		if due == nil {
+			return
+		}
+		due.f()
+	}
+}
+
+// manualTimer is a function scheduled on a manualClock.
+type manualTimer struct {
+	clock   *manualClock
+	f       func()
+	at      time.Time
+	pending bool
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.timersMutex.Lock()
+	defer t.clock.timersMutex.Unlock()
+	wasPending := t.pending
+	t.pending = false
+	return wasPending
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.timersMutex.Lock()
+	defer t.clock.timersMutex.Unlock()
+	wasPending := t.pending
+	if !slices.Contains(t.clock.timers, t) {
+		t.clock.timers = append(t.clock.timers, t)
+	}
+	t.at = t.clock.now.Add(d)
+	t.pending = true
+	return wasPending
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	type step struct {
+		// "allow", "success", "failure" or "wait"
+		action string
+		want   bool
+	}
+
+	tests := []struct {
+		name      string
+		steps     []step
+		wantState breakerState
+	}{
+		{
+			name:      "closed lets requests through",
+			steps:     []step{{"allow", true}, {"failure", false}, {"allow", true}, {"failure", false}, {"allow", true}},
+			wantState: breakerClosed,
+		},
+		{
+			name:      "opens at the threshold",
+			steps:     []step{{"failure", false}, {"failure", false}, {"failure", true}, {"allow", false}},
+			wantState: breakerOpen,
+		},
+		{
+			name:      "success resets the count",
+			steps:     []step{{"failure", false}, {"failure", false}, {"success", false}, {"failure", false}, {"failure", false}, {"allow", true}},
+			wantState: breakerClosed,
+		},
+		{
+			name:      "one trial request after the cooldown",
+			steps:     []step{{"failure", false}, {"failure", false}, {"failure", true}, {"wait", false}, {"allow", true}, {"allow", false}},
+			wantState: breakerHalfOpen,
+		},
+		{
+			name:      "successful trial closes",
+			steps:     []step{{"failure", false}, {"failure", false}, {"failure", true}, {"wait", false}, {"allow", true}, {"success", false}, {"allow", true}},
+			wantState: breakerClosed,
+		},
+		{
+			name:      "failed trial opens again",
+			steps:     []step{{"failure", false}, {"failure", false}, {"failure", true}, {"wait", false}, {"allow", true}, {"failure", true}, {"allow", false}},
+			wantState: breakerOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &manualClock{now: time.Unix(0, 0)}
+			breaker := newCircuitBreaker(3, time.Minute)
+			breaker.clock = clock
+
+			for i, s := range tt.steps {
+				var got bool
+				switch s.action {
+				case "allow":
+					got = breaker.allow()
+				case "success":
+					breaker.success()
+				case "failure":
+					got = breaker.failure()
+				case "wait":
+					clock.now = clock.now.Add(time.Minute)
+				}
+				if got != s.want {
+					t.Errorf("step %d %s = %v, want %v", i, s.action, got, s.want)
+				}
+			}
+			if breaker.state != tt.wantState {
+				t.Errorf("state = %v, want %v", breaker.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerForSettings(t *testing.T) {
+	previous := breakers
+	breakers = map[breakerKey]*circuitBreaker{}
+	t.Cleanup(func() { breakers = previous })
+
+	title := APIConfig{Endpoint: "https://api.example.com"}
+	command := APIConfig{Endpoint: "https://api.example.com", BreakerThreshold: 2, BreakerCooldown: Duration(time.Second)}
+
+	if breakerFor(title) != breakerFor(APIConfig{Endpoint: title.Endpoint, BreakerThreshold: defaultBreakerThreshold}) {
+		t.Error("unset settings got another breaker than the defaults")
+	}
+	breaker := breakerFor(command)
+	if breaker == breakerFor(title) {
+		t.Fatal("settings of one backend are shared with another backend of the same endpoint")
+	}
+	if breaker.threshold != 2 || breaker.cooldown != time.Second {
+		t.Errorf("breaker has threshold %d and cooldown %v, want 2 and 1s", breaker.threshold, breaker.cooldown)
+	}
+	if breakerFor(command) != breaker {
+		t.Error("the same settings got a new breaker")
+	}
+}
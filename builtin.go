@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// sourceURL is where the source code of the bot lives
+const sourceURL = "https://github.com/lepinkainen/gobotlite"
+
+// startTime is when the bot process started
+var startTime = time.Now()
+
+func init() {
+	registerCommand("version", func(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+		return fmt.Sprintf("gobotlite %s", Version), nil
+	})
+	registerCommand("uptime", func(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+		return fmt.Sprintf("Up for %s", formatUptime(time.Since(startTime))), nil
+	})
+	registerCommand("source", func(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+		return sourceURL, nil
+	})
+}
+
+// formatUptime formats a duration as days, hours and minutes, e.g. "3d 4h 5m".
+func formatUptime(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
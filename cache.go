@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// ttlCache is a concurrency-safe string cache whose entries expire after a fixed time.
+type ttlCache struct {
+	sync.Mutex
+	clock   Clock
+	entries map[string]cacheEntry
+	// maxEntries limits the size of the cache, unlimited when zero
+	maxEntries int
+}
+
+func newTTLCache() *ttlCache {
+	return &ttlCache{clock: defaultClock, entries: make(map[string]cacheEntry)}
+}
+
+// get returns the cached value for key if it hasn't expired.
+func (c *ttlCache) get(key string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if c.clock.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.value, true
+}
+
+// set stores a value for the given time, dropping expired entries along the way.
+func (c *ttlCache) set(key, value string, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.clock.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	// Make room by dropping the entry closest to expiring
+	if _, exists := c.entries[key]; !exists && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for k, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+// setMaxEntries limits the number of entries, zero means unlimited.
+func (c *ttlCache) setMaxEntries(n int) {
+	c.Lock()
+	defer c.Unlock()
+	c.maxEntries = n
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	cache := newTTLCache()
+	cache.clock = clock
+
+	cache.set("libera weather helsinki", "Sunny", time.Minute)
+	if value, ok := cache.get("libera weather helsinki"); !ok || value != "Sunny" {
+		t.Errorf("get() = %q, %v, want Sunny, true", value, ok)
+	}
+	if _, ok := cache.get("libera weather tampere"); ok {
+		t.Error("get() of another key = true, want false")
+	}
+
+	// Still valid at the end of the TTL, gone after it
+	clock.now = clock.now.Add(time.Minute)
+	if _, ok := cache.get("libera weather helsinki"); !ok {
+		t.Error("get() at the TTL = false, want true")
+	}
+	clock.now = clock.now.Add(time.Second)
+	if _, ok := cache.get("libera weather helsinki"); ok {
+		t.Error("get() after the TTL = true, want false")
+	}
+
+	// Empty results are cached too
+	cache.set("libera roll", "", time.Minute)
+	if value, ok := cache.get("libera roll"); !ok || value != "" {
+		t.Errorf("get() of an empty value = %q, %v, want \"\", true", value, ok)
+	}
+}
+
+func TestTTLCacheMaxEntries(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	cache := newTTLCache()
+	cache.clock = clock
+	cache.setMaxEntries(2)
+
+	cache.set("a", "1", time.Minute)
+	cache.set("b", "2", 2*time.Minute)
+	// Replacing an entry doesn't need room
+	cache.set("a", "1", 3*time.Minute)
+	if _, ok := cache.get("b"); !ok {
+		t.Error("replacing an entry dropped another one")
+	}
+
+	// The entry closest to expiring makes room
+	cache.set("c", "3", time.Minute)
+	if _, ok := cache.get("b"); ok {
+		t.Error("entry closest to expiring was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("entry %q was dropped", key)
+		}
+	}
+
+	// Expired entries go first
+	clock.now = clock.now.Add(2 * time.Minute)
+	cache.set("d", "4", time.Minute)
+	if _, ok := cache.get("a"); !ok {
+		t.Error("unexpired entry was dropped while an expired one was there")
+	}
+
+	cache.setMaxEntries(0)
+	for _, key := range []string{"e", "f", "g"} {
+		cache.set(key, key, time.Minute)
+	}
+	if n := len(cache.entries); n != 5 {
+		t.Errorf("unlimited cache has %d entries, want 5", n)
+	}
+}
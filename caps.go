@@ -0,0 +1,268 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// The IRC library only negotiates capabilities for SASL, everything else is requested
+// once the bot has registered. CAP LS 302 also turns on cap-notify, so the server
+// tells about capabilities appearing (CAP NEW) and going away (CAP DEL) mid-session.
+// Joining channels waits for the requests to be answered, otherwise the NAMES replies
+// and the first messages would arrive before multi-prefix, echo-message or batch are on.
+
+// capNegotiationTimeout is how long joining waits for a server that doesn't answer capability requests
+const capNegotiationTimeout = 5 * time.Second
+
+var (
+	wantedCapsMutex sync.Mutex
+	// wantedCaps are the capabilities the bot asks for when the server offers them
+	wantedCaps = []string{"message-tags"}
+)
+
+// capStore keeps the capabilities each server offers and has enabled for the bot.
+type capStore struct {
+	sync.Mutex
+	clock Clock
+	// connection -> capability -> value, e.g. "sasl" -> "PLAIN,EXTERNAL"
+	available    map[*irc.Connection]map[string]string
+	enabled      map[*irc.Connection]map[string]bool
+	negotiations map[*irc.Connection]*capNegotiation
+}
+
+// capNegotiation follows the capability requests made after registration.
+type capNegotiation struct {
+	// listed is set once the last line of the LS reply has arrived
+	listed bool
+	// unanswered counts the requests still waiting for an ACK or NAK
+	unanswered int
+	timer      Timer
+	// then runs once every request is answered or the timeout has passed
+	then func()
+}
+
+var caps = &capStore{
+	clock:        defaultClock,
+	available:    make(map[*irc.Connection]map[string]string),
+	enabled:      make(map[*irc.Connection]map[string]bool),
+	negotiations: make(map[*irc.Connection]*capNegotiation),
+}
+
+func init() {
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		caps.reset(conn)
+		conn.SendRaw("CAP LS 302")
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		caps.remove(conn)
+	})
+
+	registerFeature("caps", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("CAP", func(e *irc.Event) {
+			handleCap(conn, e)
+		})
+		// 421: ERR_UNKNOWNCOMMAND "<client> <command> :Unknown command" from servers without capabilities
+		conn.AddCallback("421", func(e *irc.Event) {
+			if len(e.Arguments) > 1 && strings.EqualFold(e.Arguments[1], "CAP") {
+				caps.progress(conn, func(n *capNegotiation) {
+					n.listed = true
+					n.unanswered = 0
+				})
+			}
+		})
+	})
+}
+
+// wantCap adds a capability to request from servers, features call this from init().
+func wantCap(name string) {
+	wantedCapsMutex.Lock()
+	defer wantedCapsMutex.Unlock()
+	wantedCaps = append(wantedCaps, name)
+}
+
+// isWantedCap reports whether the bot asks for a capability.
+func isWantedCap(name string) bool {
+	wantedCapsMutex.Lock()
+	defer wantedCapsMutex.Unlock()
+	for _, wanted := range wantedCaps {
+		if wanted == name {
+			return true
+		}
+	}
+	return false
+}
+
+// capEnabled reports whether a capability is enabled on the connection.
+func capEnabled(conn *irc.Connection, name string) bool {
+	caps.Lock()
+	defer caps.Unlock()
+	return caps.enabled[conn][name]
+}
+
+// parseCapList splits a capability list into names and values, e.g. "sasl=PLAIN multi-prefix".
+func parseCapList(list string) map[string]string {
+	parsed := make(map[string]string)
+	for _, token := range strings.Fields(list) {
+		name, value, _ := strings.Cut(token, "=")
+		parsed[name] = value
+	}
+	return parsed
+}
+
+func (c *capStore) reset(conn *irc.Connection) {
+	c.Lock()
+	defer c.Unlock()
+	c.available[conn] = make(map[string]string)
+	c.enabled[conn] = make(map[string]bool)
+	c.stopNegotiation(conn)
+}
+
+func (c *capStore) remove(conn *irc.Connection) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.available, conn)
+	delete(c.enabled, conn)
+	c.stopNegotiation(conn)
+}
+
+// stopNegotiation drops the negotiation of a connection without running what waits for it. The caller must hold the lock.
+func (c *capStore) stopNegotiation(conn *irc.Connection) {
+	if n, ok := c.negotiations[conn]; ok {
+		n.timer.Stop()
+		delete(c.negotiations, conn)
+	}
+}
+
+// afterNegotiation calls then once the server has answered the capability requests made after registration,
+// or once timeout has passed without that.
+func (c *capStore) afterNegotiation(conn *irc.Connection, timeout time.Duration, then func()) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.stopNegotiation(conn)
+	n := &capNegotiation{then: then}
+	n.timer = c.clock.AfterFunc(timeout, func() {
+		if c.finish(conn, n) {
+			slog.Warn("Capability negotiation timed out, continuing without it")
+		}
+	})
+	c.negotiations[conn] = n
+}
+
+// progress updates the negotiation of a connection and finishes it once every request is answered.
+func (c *capStore) progress(conn *irc.Connection, update func(n *capNegotiation)) {
+	c.Lock()
+	n, ok := c.negotiations[conn]
+	if ok {
+		update(n)
+	}
+	c.Unlock()
+
+	if ok && n.listed && n.unanswered <= 0 {
+		c.finish(conn, n)
+	}
+}
+
+// finish ends a negotiation and runs what waits for it, reporting false if it had already ended.
+func (c *capStore) finish(conn *irc.Connection, n *capNegotiation) bool {
+	c.Lock()
+	if c.negotiations[conn] != n {
+		c.Unlock()
+		return false
+	}
+	n.timer.Stop()
+	delete(c.negotiations, conn)
+	c.Unlock()
+
+	n.then()
+	return true
+}
+
+// offer records capabilities the server offers and returns the wanted ones that aren't enabled yet.
+func (c *capStore) offer(conn *irc.Connection, offered map[string]string) []string {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.available[conn] == nil {
+		c.available[conn] = make(map[string]string)
+	}
+	var request []string
+	for name, value := range offered {
+		c.available[conn][name] = value
+		if isWantedCap(name) && !c.enabled[conn][name] {
+			request = append(request, name)
+		}
+	}
+	return request
+}
+
+// withdraw forgets capabilities the server no longer offers.
+func (c *capStore) withdraw(conn *irc.Connection, names map[string]string) {
+	c.Lock()
+	defer c.Unlock()
+	for name := range names {
+		delete(c.available[conn], name)
+		delete(c.enabled[conn], name)
+	}
+}
+
+// acknowledge records the capabilities the server enabled or disabled, a "-" prefix means disabled.
+func (c *capStore) acknowledge(conn *irc.Connection, names map[string]string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.enabled[conn] == nil {
+		c.enabled[conn] = make(map[string]bool)
+	}
+	for name := range names {
+		if strings.HasPrefix(name, "-") {
+			delete(c.enabled[conn], name[1:])
+		} else {
+			c.enabled[conn][name] = true
+		}
+	}
+}
+
+// handleCap follows capability changes after registration.
+// CAP "<client> <subcommand> [*] :<capabilities>", the "*" marks a list continued on the next line.
+func handleCap(conn *irc.Connection, e *irc.Event) {
+	// Before registration the client is "*" and the IRC library is negotiating SASL
+	if len(e.Arguments) < 3 || e.Arguments[0] == "*" {
+		return
+	}
+	subcommand := strings.ToUpper(e.Arguments[1])
+	list := parseCapList(e.Arguments[len(e.Arguments)-1])
+
+	switch subcommand {
+	case "LS", "NEW":
+		// Continued LS lines are requested as they come, a request can only be so long anyway
+		request := caps.offer(conn, list)
+		if len(request) > 0 {
+			slog.Info("Requesting capabilities", "caps", strings.Join(request, " "))
+			conn.SendRawf("CAP REQ :%s", strings.Join(request, " "))
+		}
+		if subcommand == "LS" {
+			continued := len(e.Arguments) > 3 && e.Arguments[2] == "*"
+			caps.progress(conn, func(n *capNegotiation) {
+				n.listed = !continued
+				if len(request) > 0 {
+					n.unanswered++
+				}
+			})
+		}
+	case "DEL":
+		slog.Info("Capabilities removed by server", "caps", e.Arguments[len(e.Arguments)-1])
+		caps.withdraw(conn, list)
+	case "ACK":
+		slog.Info("Capabilities enabled", "caps", e.Arguments[len(e.Arguments)-1])
+		caps.acknowledge(conn, list)
+		caps.progress(conn, func(n *capNegotiation) { n.unanswered-- })
+	case "NAK":
+		slog.Warn("Capabilities rejected", "caps", e.Arguments[len(e.Arguments)-1])
+		caps.progress(conn, func(n *capNegotiation) { n.unanswered-- })
+	}
+}
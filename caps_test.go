@@ -0,0 +1,255 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestParseCapList(t *testing.T) {
+	tests := []struct {
+		list string
+		want map[string]string
+	}{
+		{list: "", want: map[string]string{}},
+		{list: "multi-prefix", want: map[string]string{"multi-prefix": ""}},
+		{list: "sasl=PLAIN,EXTERNAL message-tags", want: map[string]string{"sasl": "PLAIN,EXTERNAL", "message-tags": ""}},
+		{list: "-message-tags", want: map[string]string{"-message-tags": ""}},
+		{list: " batch  draft/chathistory=1000 ", want: map[string]string{"batch": "", "draft/chathistory": "1000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			if got := parseCapList(tt.list); !maps.Equal(got, tt.want) {
+				t.Errorf("parseCapList(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapStore(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	c := &capStore{
+		available: make(map[*irc.Connection]map[string]string),
+		enabled:   make(map[*irc.Connection]map[string]bool),
+	}
+	c.reset(conn)
+
+	request := c.offer(conn, parseCapList("message-tags sasl=PLAIN away-notify"))
+	if want := []string{"message-tags"}; !slices.Equal(request, want) {
+		t.Errorf("offer() = %q, want %q", request, want)
+	}
+
+	c.acknowledge(conn, parseCapList("message-tags"))
+	if !c.enabled[conn]["message-tags"] {
+		t.Error("acknowledged capability is not enabled")
+	}
+	// Enabled capabilities aren't requested again when offered again
+	if request := c.offer(conn, parseCapList("message-tags")); len(request) != 0 {
+		t.Errorf("offer() of an enabled capability = %q, want none", request)
+	}
+
+	c.acknowledge(conn, parseCapList("-message-tags"))
+	if c.enabled[conn]["message-tags"] {
+		t.Error("disabled capability is still enabled")
+	}
+
+	c.acknowledge(conn, parseCapList("message-tags"))
+	c.withdraw(conn, parseCapList("message-tags"))
+	if c.enabled[conn]["message-tags"] {
+		t.Error("withdrawn capability is still enabled")
+	}
+	if _, ok := c.available[conn]["message-tags"]; ok {
+		t.Error("withdrawn capability is still available")
+	}
+	if c.available[conn]["sasl"] != "PLAIN" {
+		t.Errorf("sasl = %q, want PLAIN", c.available[conn]["sasl"])
+	}
+}
+
+func TestHandleCap(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	caps.reset(conn)
+	t.Cleanup(func() { caps.remove(conn) })
+	capLine := func(args ...string) {
+		handleCap(conn, &irc.Event{Code: "CAP", Arguments: args})
+	}
+
+	// The IRC library negotiates before registration
+	capLine("*", "ACK", "message-tags")
+	if capEnabled(conn, "message-tags") {
+		t.Error("capability enabled from a line before registration")
+	}
+
+	capLine("gobot", "ACK", "message-tags")
+	if !capEnabled(conn, "message-tags") {
+		t.Error("capability was not enabled by ACK")
+	}
+
+	capLine("gobot", "DEL", "message-tags")
+	if capEnabled(conn, "message-tags") {
+		t.Error("capability is still enabled after DEL")
+	}
+
+	// Nothing wanted is offered, so nothing is requested
+	capLine("gobot", "NEW", "away-notify")
+	caps.Lock()
+	_, ok := caps.available[conn]["away-notify"]
+	caps.Unlock()
+	if !ok {
+		t.Error("capability from NEW is not available")
+	}
+
+	capLine("gobot", "NAK", "message-tags")
+	capLine("gobot", "ACK")
+}
+
+func TestCapNegotiation(t *testing.T) {
+	capLines := func(lines ...[]string) []*irc.Event {
+		var events []*irc.Event
+		for _, args := range lines {
+			events = append(events, &irc.Event{Code: "CAP", Arguments: args})
+		}
+		return events
+	}
+
+	tests := []struct {
+		name   string
+		events []*irc.Event
+		// how many lines are needed before the negotiation is done, -1 if it isn't
+		doneAfter int
+	}{
+		{
+			name:      "nothing wanted",
+			events:    capLines([]string{"gobot", "LS", "sasl"}),
+			doneAfter: 1,
+		},
+		{
+			name:      "request acknowledged",
+			events:    capLines([]string{"gobot", "LS", "multi-prefix"}, []string{"gobot", "ACK", "multi-prefix"}),
+			doneAfter: 2,
+		},
+		{
+			name:      "request rejected",
+			events:    capLines([]string{"gobot", "LS", "multi-prefix"}, []string{"gobot", "NAK", "multi-prefix"}),
+			doneAfter: 2,
+		},
+		{
+			name: "continued list",
+			events: capLines(
+				[]string{"gobot", "LS", "*", "multi-prefix"},
+				[]string{"gobot", "ACK", "multi-prefix"},
+				[]string{"gobot", "LS", "sasl"},
+			),
+			doneAfter: 3,
+		},
+		{
+			name: "a request per list line",
+			events: capLines(
+				[]string{"gobot", "LS", "*", "multi-prefix"},
+				[]string{"gobot", "LS", "message-tags"},
+				[]string{"gobot", "ACK", "multi-prefix"},
+				[]string{"gobot", "ACK", "message-tags"},
+			),
+			doneAfter: 4,
+		},
+		{
+			name:      "unanswered request",
+			events:    capLines([]string{"gobot", "LS", "multi-prefix"}),
+			doneAfter: -1,
+		},
+		{
+			name:      "server without capabilities",
+			events:    []*irc.Event{{Code: "421", Arguments: []string{"gobot", "CAP", "Unknown command"}}},
+			doneAfter: 1,
+		},
+		{
+			name:      "other unknown command",
+			events:    []*irc.Event{{Code: "421", Arguments: []string{"gobot", "FOO", "Unknown command"}}},
+			doneAfter: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &manualClock{now: time.Unix(0, 0)}
+			previous := caps.clock
+			caps.clock = clock
+			conn, _ := newServerConn(t)
+			t.Cleanup(func() {
+				caps.remove(conn)
+				caps.clock = previous
+			})
+			for _, f := range features {
+				if f.name == "caps" {
+					f.setup(&Config{}, conn)
+				}
+			}
+
+			done := 0
+			caps.reset(conn)
+			caps.afterNegotiation(conn, capNegotiationTimeout, func() { done++ })
+			for i, e := range tt.events {
+				if done > 0 {
+					t.Fatalf("negotiation was done after %d lines, want %d", i, tt.doneAfter)
+				}
+				conn.RunCallbacks(e)
+			}
+			if tt.doneAfter < 0 {
+				if done > 0 {
+					t.Fatal("negotiation was done without every request answered")
+				}
+				// Joining goes ahead without the answers in the end
+				clock.advance(capNegotiationTimeout)
+			}
+			if done != 1 {
+				t.Errorf("then ran %d times, want once", done)
+			}
+			clock.advance(capNegotiationTimeout)
+			if done != 1 {
+				t.Errorf("then ran %d times after the timeout, want once", done)
+			}
+		})
+	}
+}
+
+func TestJoinWaitsForCaps(t *testing.T) {
+	conn, lines := newServerConn(t)
+	t.Cleanup(func() {
+		caps.remove(conn)
+		members.reset(conn)
+		joins.reset(conn)
+	})
+	config := &Config{Networks: map[string]Network{"libera": {Channels: []string{"#go"}}}}
+	for _, f := range features {
+		if f.name == "events" || f.name == "caps" {
+			f.setup(config, conn)
+		}
+	}
+	trackMembers(conn)
+
+	conn.RunCallbacks(&irc.Event{Code: "001", Arguments: []string{"gobot", "Welcome"}})
+	if got, want := sentLines(t, conn, lines), []string{"CAP LS 302"}; !slices.Equal(got, want) {
+		t.Fatalf("sent %q after registering, want %q", got, want)
+	}
+
+	conn.RunCallbacks(&irc.Event{Code: "CAP", Arguments: []string{"gobot", "LS", "multi-prefix sasl"}})
+	if got, want := sentLines(t, conn, lines), []string{"CAP REQ :multi-prefix"}; !slices.Equal(got, want) {
+		t.Fatalf("sent %q after the capability list, want %q", got, want)
+	}
+
+	conn.RunCallbacks(&irc.Event{Code: "CAP", Arguments: []string{"gobot", "ACK", "multi-prefix"}})
+	if got, want := sentLines(t, conn, lines), []string{"JOIN #go"}; !slices.Equal(got, want) {
+		t.Fatalf("sent %q after the capabilities were enabled, want %q", got, want)
+	}
+
+	conn.RunCallbacks(&irc.Event{Code: "353", Arguments: []string{"gobot", "=", "#go", "@+alice +@bob"}})
+	for nick, want := range map[string]string{"alice": "@+", "bob": "@+"} {
+		if got := members.prefixes(conn, "#go", nick); got != want {
+			t.Errorf("prefixes(%q) = %q, want %q", nick, got, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	// maxOpRequests is how many times ops are requested for a channel within opRequestWindow
+	maxOpRequests   = 3
+	opRequestWindow = 10 * time.Minute
+)
+
+// opRequests keeps the bot from fighting with someone who really wants it deopped
+var opRequests = newWindowLimiter(opRequestWindow)
+
+// chanServCommands are the ChanServ commands the bot can send for itself
+var chanServCommands = []string{"OP", "INVITE", "UNBAN"}
+
+func init() {
+	registerAdminCommand("chanserv", chanServCommand)
+}
+
+// chanServNick returns the nick of ChanServ on the connection's network, empty if the network has no services.
+func chanServNick(config *Config, conn *irc.Connection) string {
+	return config.Networks[connections.name(conn)].ChanServ
+}
+
+// formatChanServ returns a ChanServ command line, e.g. "OP #channel nick".
+func formatChanServ(command, channel string, args ...string) string {
+	return strings.Join(append([]string{strings.ToUpper(command), channel}, args...), " ")
+}
+
+// sendChanServ sends a command to ChanServ and reports whether the network has services configured.
+func sendChanServ(config *Config, conn *irc.Connection, command, channel string, args ...string) bool {
+	nick := chanServNick(config, conn)
+	if nick == "" {
+		return false
+	}
+	slog.Info("Sending ChanServ command", "command", command, "channel", channel)
+	conn.Privmsg(nick, formatChanServ(command, channel, args...))
+	return true
+}
+
+// shouldHaveOps reports whether a channel is one of the op channels of the connection's network.
+func shouldHaveOps(config *Config, conn *irc.Connection, channel string) bool {
+	network := config.Networks[connections.name(conn)]
+	for _, opChannel := range network.OpChannels {
+		if strings.EqualFold(normalizeChannel(conn, opChannel), channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestOps asks ChanServ to op the bot on a channel where it should have ops.
+func requestOps(config *Config, conn *irc.Connection, channel string) {
+	if !shouldHaveOps(config, conn, channel) {
+		return
+	}
+	key := connections.name(conn) + " " + strings.ToLower(channel)
+	if allowed, first := opRequests.allow(key, maxOpRequests); !allowed {
+		if first {
+			slog.Warn("Deopped too often, not asking ChanServ for ops", "channel", channel)
+		}
+		return
+	}
+
+	slog.Info("Asking ChanServ for ops", "channel", channel)
+	sendChanServ(config, conn, "OP", channel, botNick(conn))
+}
+
+// chanServCommand handles ".chanserv <op|invite|unban> [#channel]", which always act on the bot itself
+// so that nobody can use the bot's services access for their own nick.
+func chanServCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	usage := fmt.Sprintf("Usage: chanserv <%s> [#channel]", strings.ToLower(strings.Join(chanServCommands, "|")))
+	if len(args) == 0 || len(args) > 2 {
+		return usage, nil
+	}
+
+	command := strings.ToUpper(args[0])
+	known := false
+	for _, name := range chanServCommands {
+		known = known || name == command
+	}
+	if !known {
+		return usage, nil
+	}
+
+	channel := e.Arguments[0]
+	if len(args) == 2 {
+		channel = normalizeChannel(conn, args[1])
+	} else if isPrivate(conn, e) {
+		return usage, nil
+	}
+
+	if !sendChanServ(config, conn, command, channel, botNick(conn)) {
+		return "ChanServ is not configured for this network", nil
+	}
+	return fmt.Sprintf("Sent %s for %s to ChanServ", command, channel), nil
+}
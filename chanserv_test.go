@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestShouldHaveOps(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	connections.add("libera", conn, slog.Default())
+	t.Cleanup(func() { connections.remove(conn) })
+	config := &Config{Networks: map[string]Network{"libera": {OpChannels: []string{"#Go", "ops"}}}}
+
+	tests := []struct {
+		channel string
+		want    bool
+	}{
+		{channel: "#go", want: true},
+		{channel: "#ops", want: true},
+		{channel: "#other", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			if got := shouldHaveOps(config, conn, tt.channel); got != tt.want {
+				t.Errorf("shouldHaveOps(%q) = %v, want %v", tt.channel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestOpsOnDeop(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	previous := opRequests
+	opRequests = newWindowLimiter(opRequestWindow)
+	opRequests.clock = clock
+	t.Cleanup(func() { opRequests = previous })
+
+	conn := newMembersConn(t, map[string]string{"gobot": "@"})
+	connections.add("libera", conn, slog.Default())
+	t.Cleanup(func() { connections.remove(conn) })
+	// Without a ChanServ nick the request is counted but not sent
+	config := &Config{Networks: map[string]Network{"libera": {OpChannels: []string{"#go"}}}}
+
+	deop := func(channel, nick string) {
+		handleMode(config, conn, &irc.Event{Code: "MODE", Nick: "someone", Arguments: []string{channel, "-o", nick}})
+	}
+	requests := func(channel string) int {
+		opRequests.Lock()
+		defer opRequests.Unlock()
+		return len(opRequests.events["libera "+channel])
+	}
+
+	deop("#go", "alice")
+	if n := requests("#go"); n != 0 {
+		t.Errorf("ops requested %d times after someone else was deopped", n)
+	}
+	deop("#other", "gobot")
+	if n := requests("#other"); n != 0 {
+		t.Errorf("ops requested %d times on a channel that isn't an op channel", n)
+	}
+
+	for range maxOpRequests + 2 {
+		deop("#go", "gobot")
+	}
+	if n := requests("#go"); n != maxOpRequests {
+		t.Errorf("ops requested %d times, want %d", n, maxOpRequests)
+	}
+
+	clock.now = clock.now.Add(opRequestWindow)
+	deop("#go", "gobot")
+	if n := requests("#go"); n != 1 {
+		t.Errorf("ops requested %d times after the window, want 1", n)
+	}
+}
+
+func TestFormatChanServ(t *testing.T) {
+	tests := []struct {
+		command string
+		channel string
+		args    []string
+		want    string
+	}{
+		{command: "OP", channel: "#go", args: []string{"gobot"}, want: "OP #go gobot"},
+		{command: "invite", channel: "#secret", args: []string{"gobot"}, want: "INVITE #secret gobot"},
+		{command: "UNBAN", channel: "#go", want: "UNBAN #go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatChanServ(tt.command, tt.channel, tt.args...); got != tt.want {
+				t.Errorf("formatChanServ() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChanServCommand(t *testing.T) {
+	conn := newMembersConn(t, nil)
+	connections.add("libera", conn, slog.Default())
+	t.Cleanup(func() { connections.remove(conn) })
+	// No ChanServ nick, so nothing is sent
+	config := &Config{Networks: map[string]Network{"libera": {}}}
+	const usage = "Usage: chanserv <op|invite|unban> [#channel]"
+
+	tests := []struct {
+		name   string
+		target string
+		args   []string
+		want   string
+	}{
+		{name: "no arguments", target: "#go", want: usage},
+		{name: "too many arguments", target: "#go", args: []string{"op", "#go", "alice"}, want: usage},
+		{name: "unknown command", target: "#go", args: []string{"drop"}, want: usage},
+		{name: "private without a channel", target: "gobot", args: []string{"op"}, want: usage},
+		{name: "not configured", target: "#go", args: []string{"op"}, want: "ChanServ is not configured for this network"},
+		{name: "private with a channel", target: "gobot", args: []string{"Invite", "secret"}, want: "ChanServ is not configured for this network"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &irc.Event{Code: "PRIVMSG", Nick: "owner", Arguments: []string{tt.target, ".chanserv"}}
+			got, err := chanServCommand(config, conn, e, tt.args)
+			if err != nil {
+				t.Fatalf("chanServCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("chanServCommand(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+
+	if !isAdminCommand(config, "chanserv") {
+		t.Error("chanserv is not an admin command")
+	}
+}
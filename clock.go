@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// Clock tells the time, time-dependent features take one instead of calling the time package directly.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f in its own goroutine once d has passed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call from Clock.AfterFunc, *time.Timer for the system clock.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// systemClock is the real wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// defaultClock is the clock features use unless they are given another one
+var defaultClock Clock = systemClock{}
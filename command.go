@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
 	"strings"
+	"time"
 
 	irc "github.com/thoj/go-ircevent"
 )
@@ -24,42 +23,53 @@ type CommandResponse struct {
 	ErrorMessage string `json:"errorMessage"`
 }
 
-// fetchLambdaCommand sends a POST request to a Lambda function endpoint with a given payload, and returns the result or an error.
-func fetchLambdaCommand(config *Config, payload *CommandPayload) (string, error) {
-	// Marshal the payload struct into JSON format
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
-	}
+// commandFunc is a command handled locally by the bot. It returns the reply to send back, if any,
+// which is sent even with an error so a failing command can still answer the user.
+type commandFunc func(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error)
 
-	fmt.Printf("Calling lambda command with payload %s\n", data)
+// localCommands holds the commands that are handled without calling the command backend, keyed by lowercase name.
+var localCommands = map[string]commandFunc{}
 
-	// Construct the HTTP request
-	req, err := http.NewRequest("POST", config.LambdaCommand.Endpoint, bytes.NewBuffer(data))
-	if err != nil {
-		return "", fmt.Errorf("error constructing request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", config.LambdaCommand.APIKey)
+// registerCommand adds a locally handled command, features call this from init().
+func registerCommand(name string, fn commandFunc) {
+	localCommands[strings.ToLower(name)] = fn
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error doing request: %w", err)
+// defaultCommandCacheTTL is how long idempotent command results are cached by default
+const defaultCommandCacheTTL = time.Minute
+
+// commandResults caches the results of idempotent commands keyed by command and arguments
+var commandResults = newTTLCache()
+
+// isIdempotent reports whether the command is configured as idempotent.
+func isIdempotent(config *Config, command string) bool {
+	for _, name := range config.CommandBackend.Idempotent {
+		if strings.EqualFold(name, command) {
+			return true
+		}
 	}
-	defer resp.Body.Close()
+	return false
+}
+
+// commandCacheKey returns the key the result of an idempotent command is cached under.
+// Commands can answer differently on each network, e.g. with network specific data.
+func commandCacheKey(conn *irc.Connection, payload *CommandPayload) string {
+	return connections.name(conn) + " " + strings.ToLower(payload.Command) + " " + payload.Args
+}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+// fetchCommand sends a request to the command backend with a given payload, and returns the result or an error.
+func fetchCommand(config *Config, logger *slog.Logger, payload *CommandPayload) (string, error) {
+	// Marshal the payload struct into JSON format
+	data, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("error reading response body: %w", err)
+		return "", err
 	}
 
-	// Unmarshal the response body into a CommandResponse struct
+	logger.Info("Calling command backend", "payload", string(data))
+
 	var response CommandResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	if err := callAPI(config.CommandBackend.APIConfig, payload, &response); err != nil {
+		return "", err
 	}
 
 	// Check if the response has an error message
@@ -71,17 +81,57 @@ func fetchLambdaCommand(config *Config, payload *CommandPayload) (string, error)
 	return response.Result, nil
 }
 
-// handleCommand handles an IRC command by sending it to a Lambda function for processing and sending the response back to the IRC connection.
+// handleCommand handles an IRC command by sending it to the command backend for processing and sending the response back to the IRC connection.
 // It takes in a `Config` struct pointer, an IRC connection pointer, an IRC event pointer, and a string representing the command as arguments.
-func handleCommand(config *Config, conn *irc.Connection, e *irc.Event, commandStr string) error {
+func handleCommand(config *Config, conn *irc.Connection, logger *slog.Logger, e *irc.Event, commandStr string) error {
 	// Validate input
-	if commandStr == "" {
+	if strings.TrimSpace(commandStr) == "" {
 		return errors.New("empty command string")
 	}
 
 	// Split command string into command and arguments
 	command, args := splitCommandString(commandStr)
 
+	// Users who asked to be ignored can only take it back
+	if !isOptOutCommand(command[0]) && isOptedOut(config, conn, logger, e.Nick) {
+		logger.Debug("Ignoring command from opted out user", "nick", e.Nick, "command", command[0])
+		return nil
+	}
+
+	if isAdminCommand(config, command[0]) && !isAdmin(config, e.Source) {
+		logger.Info("Denied admin command", "source", e.Source, "command", command[0])
+		sendReply(config, conn, replyTarget(conn, e), fmt.Sprintf("Sorry, only admins can use %s%s", commandPrefix(config), command[0]))
+		return nil
+	}
+
+	// Local commands take precedence over the backend
+	if fn, ok := localCommands[strings.ToLower(command[0])]; ok {
+		response, err := fn(config, conn, e, args)
+		if response != "" {
+			sendReply(config, conn, replyTarget(conn, e), response)
+		}
+		if err != nil {
+			return fmt.Errorf("error handling local command %s: %w", command[0], err)
+		}
+		return nil
+	}
+
+	// Remote commands are disabled without an endpoint
+	if config.CommandBackend.Endpoint == "" {
+		return nil
+	}
+
+	// Don't bother the backend with commands it doesn't know
+	if config.CommandBackend.Suggest && len(config.CommandBackend.Commands) > 0 && !isRemoteCommand(config, command[0]) {
+		prefix := commandPrefix(config)
+		reply := fmt.Sprintf("Unknown command %s%s", prefix, command[0])
+		if suggestion := suggestCommand(config, command[0]); suggestion != "" {
+			reply += fmt.Sprintf(", did you mean %s%s?", prefix, suggestion)
+		}
+		sendReply(config, conn, replyTarget(conn, e), reply)
+		return nil
+	}
+
 	// Create a CommandPayload struct with the command, arguments, channel, and user information
 	payload := &CommandPayload{
 		Command: strings.Join(command, " "),
@@ -90,15 +140,37 @@ func handleCommand(config *Config, conn *irc.Connection, e *irc.Event, commandSt
 		User:    e.Source,
 	}
 
-	// Call the fetchLambdaCommand function to send the payload to the Lambda function and get the response
-	response, err := fetchLambdaCommand(config, payload)
+	idempotent := isIdempotent(config, payload.Command)
+	cacheKey := commandCacheKey(conn, payload)
+	if idempotent {
+		if response, ok := commandResults.get(cacheKey); ok {
+			if response != "" {
+				sendReply(config, conn, replyTarget(conn, e), response)
+			}
+			return nil
+		}
+	}
+
+	// Call the fetchCommand function to send the payload to the backend and get the response
+	response, err := fetchCommand(config, logger, payload)
 	if err != nil {
-		return fmt.Errorf("error handling lambda command: %w", err)
+		if fallback, ok := commandFallback(config, payload.Command); ok && isUnreachable(err) {
+			sendReply(config, conn, replyTarget(conn, e), fallback)
+		}
+		return fmt.Errorf("error handling backend command: %w", err)
+	}
+
+	if idempotent {
+		ttl := time.Duration(config.CommandBackend.CacheTTL)
+		if ttl <= 0 {
+			ttl = defaultCommandCacheTTL
+		}
+		commandResults.set(cacheKey, response, ttl)
 	}
 
 	if response != "" {
 		// Send the response back to the IRC connection
-		conn.Privmsg(e.Arguments[0], response)
+		sendReply(config, conn, replyTarget(conn, e), response)
 	}
 
 	return nil
@@ -112,3 +184,71 @@ func splitCommandString(commandStr string) ([]string, []string) {
 	}
 	return fields[:1], nil
 }
+
+// maxSuggestionDistance is the largest edit distance at which a command is still suggested
+const maxSuggestionDistance = 2
+
+// commandFallback returns the configured reply for a command while the backend is unreachable.
+func commandFallback(config *Config, command string) (string, bool) {
+	for name, reply := range config.CommandBackend.Fallback {
+		if strings.EqualFold(name, command) {
+			return reply, true
+		}
+	}
+	reply, ok := config.CommandBackend.Fallback["*"]
+	return reply, ok
+}
+
+// isRemoteCommand reports whether the command is one of the configured backend commands.
+func isRemoteCommand(config *Config, command string) bool {
+	for _, known := range config.CommandBackend.Commands {
+		if strings.EqualFold(known, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestCommand returns the known command closest to command, or an empty string if none is close enough.
+func suggestCommand(config *Config, command string) string {
+	known := append([]string{}, config.CommandBackend.Commands...)
+	for name := range localCommands {
+		known = append(known, name)
+	}
+
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, name := range known {
+		distance := levenshtein(strings.ToLower(command), strings.ToLower(name))
+		// Prefer the alphabetically first command on ties so the result is stable
+		if distance < bestDistance || (distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	if bestDistance > maxSuggestionDistance {
+		return ""
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestCommandCacheKey(t *testing.T) {
+	libera := irc.IRC("gobot", "gobot")
+	oftc := irc.IRC("gobot", "gobot")
+	connections.add("libera", libera, slog.Default())
+	connections.add("oftc", oftc, slog.Default())
+	t.Cleanup(func() {
+		connections.remove(libera)
+		connections.remove(oftc)
+	})
+
+	weather := &CommandPayload{Command: "Weather", Args: "Helsinki"}
+	tests := []struct {
+		name     string
+		a, b     *irc.Connection
+		pa, pb   *CommandPayload
+		wantSame bool
+	}{
+		{name: "same command on the same network", a: libera, b: libera, pa: weather, pb: &CommandPayload{Command: "weather", Args: "Helsinki"}, wantSame: true},
+		{name: "other network", a: libera, b: oftc, pa: weather, pb: weather, wantSame: false},
+		{name: "other arguments", a: libera, b: libera, pa: weather, pb: &CommandPayload{Command: "weather", Args: "Tampere"}, wantSame: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same := commandCacheKey(tt.a, tt.pa) == commandCacheKey(tt.b, tt.pb)
+			if same != tt.wantSame {
+				t.Errorf("keys equal = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	config := &Config{CommandBackend: CommandConfig{Idempotent: []string{"Weather", "time"}}}
+
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{command: "weather", want: true},
+		{command: "TIME", want: true},
+		{command: "roll", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := isIdempotent(config, tt.command); got != tt.want {
+				t.Errorf("isIdempotent(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "weather", b: "weather", want: 0},
+		{a: "", b: "abc", want: 3},
+		{a: "weathr", b: "weather", want: 1},
+		{a: "wetaher", b: "weather", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "sää", b: "saa", want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := levenshtein(tt.a, tt.b); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := levenshtein(tt.b, tt.a); got != tt.want {
+				t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestCommand(t *testing.T) {
+	config := &Config{CommandBackend: CommandConfig{Commands: []string{"weather", "wiki", "roll"}}}
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "weathr", want: "weather"},
+		{command: "WEATER", want: "weather"},
+		{command: "wik", want: "wiki"},
+		{command: "rol", want: "roll"},
+		{command: "versoin", want: "version"},
+		{command: "completelydifferent", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := suggestCommand(config, tt.command); got != tt.want {
+				t.Errorf("suggestCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandFallback(t *testing.T) {
+	config := &Config{CommandBackend: CommandConfig{Fallback: map[string]string{
+		"Weather": "The weather service is down",
+		"*":       "The command backend is down",
+	}}}
+
+	tests := []struct {
+		name      string
+		config    *Config
+		command   string
+		wantReply string
+		wantOK    bool
+	}{
+		{name: "command fallback", config: config, command: "weather", wantReply: "The weather service is down", wantOK: true},
+		{name: "wildcard fallback", config: config, command: "quote", wantReply: "The command backend is down", wantOK: true},
+		{name: "no fallbacks", config: &Config{}, command: "weather", wantOK: false},
+		{
+			name:      "no wildcard",
+			config:    &Config{CommandBackend: CommandConfig{Fallback: map[string]string{"weather": "down"}}},
+			command:   "quote",
+			wantReply: "",
+			wantOK:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, ok := commandFallback(tt.config, tt.command)
+			if reply != tt.wantReply || ok != tt.wantOK {
+				t.Errorf("commandFallback(%q) = %q, %v, want %q, %v", tt.command, reply, ok, tt.wantReply, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFetchCommandUnreachable(t *testing.T) {
+	useInstantClock(t)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	tests := []struct {
+		name            string
+		endpoint        string
+		wantUnreachable bool
+	}{
+		// Only a backend that can't be reached gets the fallback reply
+		{name: "backend down", endpoint: down.URL, wantUnreachable: true},
+		{name: "backend rejects the request", endpoint: rejecting.URL, wantUnreachable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{CommandBackend: CommandConfig{APIConfig: APIConfig{Endpoint: tt.endpoint}}}
+			_, err := fetchCommand(config, discardLogger, &CommandPayload{Command: "weather"})
+			if err == nil {
+				t.Fatal("fetchCommand() error = nil")
+			}
+			if got := isUnreachable(err); got != tt.wantUnreachable {
+				t.Errorf("isUnreachable(%v) = %v, want %v", err, got, tt.wantUnreachable)
+			}
+		})
+	}
+}
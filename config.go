@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+type Network struct {
+	// Nick used on this network, overrides the global nickname when set
+	Nickname string   `yaml:"nickname"`
+	Channels []string `yaml:"channels"`
+	Server   string   `yaml:"server"`
+	UseTLS   bool     `yaml:"usetls"`
+	Port     int      `yaml:"port"`
+	// Character encoding used by the network, e.g. ISO-8859-1. UTF-8 when unset
+	Encoding string `yaml:"encoding"`
+	// Channel where error level log messages are sent
+	LogChannel string `yaml:"logChannel"`
+	// Glob patterns of channels to join when invited, e.g. "#project-*"
+	InviteChannels []string `yaml:"inviteChannels"`
+	// Nick of the channel services bot, ChanServ integration is off when unset
+	ChanServ string `yaml:"chanServ"`
+	// Nick and password of the nick services bot, used to identify and to GHOST or RELEASE the bot's nick when it's taken
+	NickServ         string `yaml:"nickServ"`
+	NickServPassword string `yaml:"nickServPassword"`
+	// Channels where the bot should have ops, they are requested from ChanServ when the bot is deopped
+	OpChannels []string `yaml:"opChannels"`
+	// Command to run when someone sends just the command prefix, by channel, e.g. "#help": "help"
+	DefaultCommands map[string]string `yaml:"defaultCommands"`
+	// Nicks whose messages are ignored on this network, in addition to the global list
+	IgnoredNicks []string `yaml:"ignoredNicks"`
+	// Title templates by channel, e.g. "#news": "[title] {title} — {host}", the title backend format when unset
+	TitleFormats map[string]string `yaml:"titleFormats"`
+}
+
+// encoding returns the configured character encoding of the network, nil means UTF-8 as is.
+func (n Network) encoding() (encoding.Encoding, error) {
+	if n.Encoding == "" || strings.EqualFold(n.Encoding, "utf-8") || strings.EqualFold(n.Encoding, "utf8") {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(n.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported encoding: %s", n.Encoding)
+	}
+	return enc, nil
+}
+
+// ApplyLegacyKeys moves the backends configured under their old lambda* names to the new ones.
+func (c *Config) ApplyLegacyKeys() error {
+	if c.LegacyTitle != nil {
+		if c.TitleBackend.Endpoint != "" {
+			return fmt.Errorf("both lambdatitle and titlebackend are configured")
+		}
+		c.TitleBackend = *c.LegacyTitle
+		c.LegacyTitle = nil
+	}
+	if c.LegacyCommand != nil {
+		if c.CommandBackend.Endpoint != "" {
+			return fmt.Errorf("both lambdacommand and commandbackend are configured")
+		}
+		c.CommandBackend = *c.LegacyCommand
+		c.LegacyCommand = nil
+	}
+	return nil
+}
+
+// loadAPIKey reads the API key from APIKeyFile if one is configured.
+func (a *APIConfig) loadAPIKey() error {
+	if a.APIKeyFile == "" {
+		return nil
+	}
+	if a.APIKey != "" {
+		return fmt.Errorf("both apiKey and apiKeyFile are set")
+	}
+	data, err := os.ReadFile(a.APIKeyFile)
+	if err != nil {
+		return fmt.Errorf("error reading API key file: %w", err)
+	}
+	a.APIKey = strings.TrimSpace(string(data))
+	return nil
+}
+
+// LoadSecrets reads the secrets that are stored in separate files.
+func (c *Config) LoadSecrets() error {
+	apis := map[string]*APIConfig{
+		"titlebackend":   &c.TitleBackend.APIConfig,
+		"commandbackend": &c.CommandBackend.APIConfig,
+		"addconfig":      &c.Addit,
+	}
+	for name, api := range apis {
+		if err := api.loadAPIKey(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Duration is a time.Duration that can be written as "90s" or "5m" in the configuration.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+type APIConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	APIKey   string `yaml:"apiKey"`
+	// How the API key is sent: "apikey" in the x-api-key header (default), "bearer" as an
+	// Authorization bearer token, "header" in AuthHeader, or "none"
+	AuthType   string `yaml:"authType"`
+	AuthHeader string `yaml:"authHeader"`
+	// File containing the API key, e.g. a mounted Docker or Kubernetes secret
+	APIKeyFile string `yaml:"apiKeyFile"`
+	// Largest accepted response body in bytes, defaults to 1 MiB
+	MaxResponseSize int64 `yaml:"maxResponseSize"`
+	// Extra headers sent with every request
+	Headers map[string]string `yaml:"headers"`
+	// HTTP method, POST sends the payload as JSON and GET as query parameters. Defaults to POST
+	Method string `yaml:"method"`
+	// How long a request may take, reading the response included, 10s when unset
+	Timeout Duration `yaml:"timeout"`
+	// Log requests and responses with secrets redacted, for debugging the backend.
+	// They are logged at info level, so this works without setting logging.level to debug
+	Debug bool `yaml:"debug"`
+	// Stop calling the endpoint for BreakerCooldown after this many consecutive failures, 5 and 1m when unset
+	BreakerThreshold int      `yaml:"breakerThreshold"`
+	BreakerCooldown  Duration `yaml:"breakerCooldown"`
+}
+
+type TitleConfig struct {
+	APIConfig `yaml:",inline"`
+	// Secondary endpoints tried in order when the endpoint can't be reached, with the same settings
+	FailoverEndpoints []string `yaml:"failoverEndpoints"`
+	Shorteners        []string `yaml:"shorteners"`
+	// Template for each announced title, {title}, {url} and {host} are expanded. "Title: {title}" when unset
+	Format string `yaml:"format"`
+	// Domains that are never looked up, subdomains included
+	IgnoredDomains []string `yaml:"ignoredDomains"`
+	// Ports URLs may have to be looked up, 80 and 443 when unset. URLs without a port are always allowed
+	AllowedPorts []int `yaml:"allowedPorts"`
+	// Maximum number of URLs looked up from a single message, 2 when unset
+	MaxURLsPerMessage int `yaml:"maxURLsPerMessage"`
+	// Collect titles for this long and announce them together, off when unset
+	BatchWindow Duration `yaml:"batchWindow"`
+	// Maximum number of titles combined on a single line when batching
+	BatchSize int `yaml:"batchSize"`
+	// Maximum number of titles announced per user per minute, unlimited when unset
+	MaxPerUser int `yaml:"maxPerUser"`
+	// Minimum time between title replies in one channel, excess replies are queued, off when unset
+	ChannelInterval Duration `yaml:"channelInterval"`
+	// Don't look up the same URL in a channel again within this time, 60s when unset and off when negative
+	DedupWindow Duration `yaml:"dedupWindow"`
+	// How long looked up titles are cached for any channel, 10m when unset and off when negative
+	CacheTTL Duration `yaml:"cacheTTL"`
+	// Maximum number of cached titles, 1000 when unset
+	CacheMaxEntries int `yaml:"cacheMaxEntries"`
+}
+
+// SecurityConfig holds settings that weaken or harden the defaults of the bot.
+type SecurityConfig struct {
+	// Skip TLS certificate verification, only for servers with self-signed certificates
+	AllowInsecureTLS bool `yaml:"allowInsecureTLS"`
+	// Limits the command and title replies sent to each channel or user
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+}
+
+// RateLimitConfig is a token bucket, Rate messages per second with bursts of up to Burst messages.
+type RateLimitConfig struct {
+	Enabled bool    `yaml:"enabled"`
+	Rate    float64 `yaml:"rate"`
+	Burst   int     `yaml:"burst"`
+}
+
+// LoggingConfig sets up the log output of the bot.
+type LoggingConfig struct {
+	// Lowest level logged: debug, info, warn or error. Defaults to info
+	Level string `yaml:"level"`
+	// Log format, text or json. Defaults to text
+	Format string `yaml:"format"`
+}
+
+type RelayEndpoint struct {
+	Network string `yaml:"network"`
+	Channel string `yaml:"channel"`
+}
+
+// RelayConfig forwards messages from one channel to another, add a second relay for the other direction.
+type RelayConfig struct {
+	From RelayEndpoint `yaml:"from"`
+	To   RelayEndpoint `yaml:"to"`
+	// Nicks of other bots relaying into the From channel, their messages aren't relayed back
+	Peers []string `yaml:"peers"`
+}
+
+type CommandConfig struct {
+	APIConfig `yaml:",inline"`
+	// Commands served by the backend, only needed for suggestions
+	Commands []string `yaml:"commands"`
+	// Suggest the closest known command instead of forwarding unknown ones, requires Commands
+	Suggest bool `yaml:"suggest"`
+	// Commands whose result only depends on their arguments, repeated calls are answered from a cache
+	Idempotent []string `yaml:"idempotent"`
+	// How long idempotent results are cached, defaults to one minute
+	CacheTTL Duration `yaml:"cacheTTL"`
+	// Backend commands only admins can run
+	AdminOnly []string `yaml:"adminOnly"`
+	// Replies used by command when the backend can't be reached, "*" matches any other command
+	Fallback map[string]string `yaml:"fallback"`
+}
+
+type CTCPConfig struct {
+	// Go time layout used for CTCP TIME replies, RFC1123 when unset
+	TimeFormat string `yaml:"timeFormat"`
+	// CTCP requests that get no reply, e.g. VERSION, TIME, PING
+	Disabled []string `yaml:"disabled"`
+	// Custom replies by CTCP request, e.g. SOURCE. {nick} and {version} are expanded
+	Responses map[string]string `yaml:"responses"`
+}
+
+type NotesConfig struct {
+	MaxNotes  int `yaml:"maxNotes"`
+	MaxLength int `yaml:"maxLength"`
+}
+
+type Config struct {
+	Networks       map[string]Network `yaml:"networks"`
+	Nickname       string             `yaml:"nickname"`
+	TitleBackend   TitleConfig        `yaml:"titlebackend"`
+	CommandBackend CommandConfig      `yaml:"commandbackend"`
+	// Deprecated: the original names of the backends, use titlebackend and commandbackend
+	LegacyTitle   *TitleConfig   `yaml:"lambdatitle"`
+	LegacyCommand *CommandConfig `yaml:"lambdacommand"`
+	Addit         APIConfig      `yaml:"addconfig"`
+	DataDir       string         `yaml:"dataDir"`
+	Notes         NotesConfig    `yaml:"notes"`
+	CTCP          CTCPConfig     `yaml:"ctcp"`
+	RejoinMessage string         `yaml:"rejoinMessage"`
+	// Hostmasks of the users who can run admin commands, e.g. "*!*@user/owner", * and ? are wildcards
+	Admins []string `yaml:"admins"`
+	// Nicks whose messages are ignored, e.g. other bots
+	IgnoredNicks []string `yaml:"ignoredNicks"`
+	// Messages starting with one of these are relayed by bridges and never trigger commands or titles, defaults to "*"
+	BridgePrefixes []string      `yaml:"bridgePrefixes"`
+	Relays         []RelayConfig `yaml:"relays"`
+	// Character that starts commands, defaults to "."
+	CommandPrefix string `yaml:"commandPrefix"`
+	// Treat private messages from admins without the command prefix as commands
+	BarePrivateCommands bool `yaml:"barePrivateCommands"`
+	// Leave channels that have had nobody but the bot on them for this long, off when unset
+	EmptyChannelTimeout Duration `yaml:"emptyChannelTimeout"`
+	// Log netsplits once instead of every quit and rejoin they cause
+	SuppressNetsplits bool `yaml:"suppressNetsplits"`
+	// Ignore commands and URLs for this long after connecting, off when unset
+	StartupGrace Duration `yaml:"startupGrace"`
+	// Join channels again this many times if the join isn't confirmed within JoinTimeout, off when unset
+	JoinRetries int      `yaml:"joinRetries"`
+	JoinTimeout Duration `yaml:"joinTimeout"`
+	// How many alternative nicks to try when registering before giving up, 5 when unset
+	MaxNickAttempts int `yaml:"maxNickAttempts"`
+	// How often and how many times to try taking back the nick after ending up with another one,
+	// every minute up to 10 times when unset. A negative interval turns this off
+	NickRecoveryInterval Duration       `yaml:"nickRecoveryInterval"`
+	NickRecoveryAttempts int            `yaml:"nickRecoveryAttempts"`
+	Security             SecurityConfig `yaml:"security"`
+	Logging              LoggingConfig  `yaml:"logging"`
+	// Longest message text sent on one line in bytes, longer messages are split. Fits the server's line length when unset
+	MaxMessageLength int `yaml:"maxMessageLength"`
+	// How many more lines a long command or title reply may take, 3 when unset and none when negative
+	MaxContinuationLines int `yaml:"maxContinuationLines"`
+	// Sent with QUIT when the bot is shut down
+	QuitMessage string `yaml:"quitMessage"`
+	// How many times a failed first connection to a network is retried, without a limit when unset
+	ConnectRetries int `yaml:"connectRetries"`
+	// How many times a network that stopped, e.g. because connecting gave up, is started again after
+	// NetworkRestartDelay. 5 times after a minute when unset, never when negative
+	MaxNetworkRestarts  int      `yaml:"maxNetworkRestarts"`
+	NetworkRestartDelay Duration `yaml:"networkRestartDelay"`
+}
+
+// nickname returns the nick to use on a network, falling back to the global nickname.
+func (c *Config) nickname(network Network) string {
+	if network.Nickname != "" {
+		return network.Nickname
+	}
+	return c.Nickname
+}
+
+func (c *Config) Validate() error {
+	if c.Nickname == "" && len(c.Networks) == 0 {
+		return fmt.Errorf("nickname is missing from configuration")
+	}
+	if c.CTCP.TimeFormat != "" {
+		if err := validateTimeFormat(c.CTCP.TimeFormat); err != nil {
+			return err
+		}
+	}
+	if err := validateCTCP(c.CTCP); err != nil {
+		return err
+	}
+	if err := validateCommandPrefix(c.CommandPrefix); err != nil {
+		return err
+	}
+	if limit := c.Security.RateLimit; limit.Enabled && (limit.Rate <= 0 || limit.Burst < 1) {
+		return fmt.Errorf("security.rateLimit needs a positive rate and a burst of at least 1")
+	}
+	for name, api := range map[string]APIConfig{
+		"titlebackend":   c.TitleBackend.APIConfig,
+		"commandbackend": c.CommandBackend.APIConfig,
+		"addconfig":      c.Addit,
+	} {
+		if method := strings.ToUpper(api.Method); method != "" && method != http.MethodGet && method != http.MethodPost {
+			return fmt.Errorf("unsupported method for %s: %s", name, api.Method)
+		}
+		switch strings.ToLower(api.AuthType) {
+		case "", "apikey", "bearer", "none":
+		case "header":
+			if api.AuthHeader == "" {
+				return fmt.Errorf("authHeader is required for header auth in %s", name)
+			}
+		default:
+			return fmt.Errorf("unsupported authType for %s: %s", name, api.AuthType)
+		}
+	}
+	if len(c.TitleBackend.FailoverEndpoints) > 0 && c.TitleBackend.Endpoint == "" {
+		return fmt.Errorf("titlebackend failoverEndpoints need an endpoint to be set")
+	}
+	for networkName, network := range c.Networks {
+		if c.nickname(network) == "" {
+			return fmt.Errorf("nickname is missing from configuration for network: %s", networkName)
+		}
+		if network.Server == "" {
+			return fmt.Errorf("server is missing from configuration for network: %s", networkName)
+		}
+		if len(network.Channels) == 0 {
+			return fmt.Errorf("no channels specified in configuration for network: %s", networkName)
+		}
+		if _, err := network.encoding(); err != nil {
+			return fmt.Errorf("invalid encoding for network %s: %w", networkName, err)
+		}
+		if err := validateInvitePatterns(network.InviteChannels); err != nil {
+			return fmt.Errorf("network %s: %w", networkName, err)
+		}
+		if network.NickServPassword != "" && network.NickServ == "" {
+			return fmt.Errorf("nickServPassword of network %s needs nickServ to be set", networkName)
+		}
+		if len(network.OpChannels) > 0 && network.ChanServ == "" {
+			return fmt.Errorf("opChannels of network %s need chanServ to be set", networkName)
+		}
+		// More specific validations can be added here, such as checking the port range, TLS config, etc.
+	}
+	return validateRelays(c)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestNetworkEncoding(t *testing.T) {
+	tests := []struct {
+		encoding string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{encoding: "", wantNil: true},
+		{encoding: "UTF-8", wantNil: true},
+		{encoding: "utf8", wantNil: true},
+		{encoding: "ISO-8859-1"},
+		{encoding: "latin1"},
+		{encoding: "windows-1252"},
+		{encoding: "klingon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			enc, err := Network{Encoding: tt.encoding}.encoding()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encoding() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (enc == nil) != (tt.wantNil || tt.wantErr) {
+				t.Errorf("encoding() = %v, want nil %v", enc, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestNetworkEncodingRoundTrip(t *testing.T) {
+	enc, err := Network{Encoding: "ISO-8859-1"}.encoding()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := "Hyvää päivää, ÅÄÖ"
+	encoded, err := enc.NewEncoder().String(message)
+	if err != nil {
+		t.Fatalf("encoding error = %v", err)
+	}
+	if len(encoded) != len([]rune(message)) {
+		t.Errorf("encoded length = %d, want one byte per character (%d)", len(encoded), len([]rune(message)))
+	}
+	decoded, err := enc.NewDecoder().String(encoded)
+	if err != nil {
+		t.Fatalf("decoding error = %v", err)
+	}
+	if decoded != message {
+		t.Errorf("round trip = %q, want %q", decoded, message)
+	}
+}
+
+func TestLoadAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		api     APIConfig
+		wantKey string
+		wantErr bool
+	}{
+		{name: "inline key", api: APIConfig{APIKey: "inline"}, wantKey: "inline"},
+		{name: "no key", api: APIConfig{}, wantKey: ""},
+		{name: "key file", api: APIConfig{APIKeyFile: keyFile}, wantKey: "s3cret"},
+		{name: "both set", api: APIConfig{APIKey: "inline", APIKeyFile: keyFile}, wantErr: true},
+		{name: "missing file", api: APIConfig{APIKeyFile: filepath.Join(dir, "missing")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.api.loadAPIKey()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && tt.api.APIKey != tt.wantKey {
+				t.Errorf("APIKey = %q, want %q", tt.api.APIKey, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("s3cret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		TitleBackend:   TitleConfig{APIConfig: APIConfig{APIKeyFile: keyFile}},
+		CommandBackend: CommandConfig{APIConfig: APIConfig{APIKeyFile: keyFile}},
+		Addit:          APIConfig{APIKeyFile: keyFile},
+	}
+	if err := config.LoadSecrets(); err != nil {
+		t.Fatalf("LoadSecrets() error = %v", err)
+	}
+	for name, key := range map[string]string{
+		"titlebackend":   config.TitleBackend.APIKey,
+		"commandbackend": config.CommandBackend.APIKey,
+		"addconfig":      config.Addit.APIKey,
+	} {
+		if key != "s3cret" {
+			t.Errorf("%s key = %q, want s3cret", name, key)
+		}
+	}
+}
+
+func TestValidateOptionalBackends(t *testing.T) {
+	base := func() Config {
+		return Config{
+			Nickname: "gobot",
+			Networks: map[string]Network{"libera": {Server: "irc.libera.chat", Channels: []string{"#gobot"}}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{name: "no backends", modify: func(c *Config) {}},
+		{name: "only the title backend", modify: func(c *Config) { c.TitleBackend.Endpoint = "https://example.com/title" }},
+		{name: "only the command backend", modify: func(c *Config) { c.CommandBackend.Endpoint = "https://example.com/command" }},
+		{name: "both backends", modify: func(c *Config) {
+			c.TitleBackend.Endpoint = "https://example.com/title"
+			c.CommandBackend.Endpoint = "https://example.com/command"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base()
+			tt.modify(&config)
+			if err := config.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyLegacyKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		yaml        string
+		wantTitle   string
+		wantCommand string
+		wantErr     bool
+	}{
+		{
+			name:        "current keys",
+			yaml:        "titlebackend:\n  endpoint: https://example.com/title\ncommandbackend:\n  endpoint: https://example.com/command\n",
+			wantTitle:   "https://example.com/title",
+			wantCommand: "https://example.com/command",
+		},
+		{
+			name:        "legacy keys",
+			yaml:        "lambdatitle:\n  endpoint: https://example.com/title\n  apiKey: key\nlambdacommand:\n  endpoint: https://example.com/command\n",
+			wantTitle:   "https://example.com/title",
+			wantCommand: "https://example.com/command",
+		},
+		{
+			name:        "mixed keys",
+			yaml:        "lambdatitle:\n  endpoint: https://example.com/title\ncommandbackend:\n  endpoint: https://example.com/command\n",
+			wantTitle:   "https://example.com/title",
+			wantCommand: "https://example.com/command",
+		},
+		{
+			name:    "both title keys",
+			yaml:    "lambdatitle:\n  endpoint: https://example.com/old\ntitlebackend:\n  endpoint: https://example.com/new\n",
+			wantErr: true,
+		},
+		{
+			name:    "both command keys",
+			yaml:    "lambdacommand:\n  endpoint: https://example.com/old\ncommandbackend:\n  endpoint: https://example.com/new\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			if err := yaml.Unmarshal([]byte(tt.yaml), &config); err != nil {
+				t.Fatal(err)
+			}
+			err := config.ApplyLegacyKeys()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyLegacyKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.TitleBackend.Endpoint != tt.wantTitle {
+				t.Errorf("title endpoint = %q, want %q", config.TitleBackend.Endpoint, tt.wantTitle)
+			}
+			if config.CommandBackend.Endpoint != tt.wantCommand {
+				t.Errorf("command endpoint = %q, want %q", config.CommandBackend.Endpoint, tt.wantCommand)
+			}
+			if config.LegacyTitle != nil || config.LegacyCommand != nil {
+				t.Error("legacy keys are still set")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	// initialConnectBackoff is the wait after the first failed connection attempt, doubled after every failure
+	initialConnectBackoff = 5 * time.Second
+	// maxConnectBackoff caps the wait between connection attempts
+	maxConnectBackoff = 5 * time.Minute
+)
+
+// connectBackoff returns how long to wait after the given number of failed attempts.
+// Up to a quarter is added at random so clients dropped together don't all come back at once.
+func connectBackoff(attempt int) time.Duration {
+	backoff := initialConnectBackoff
+	for i := 1; i < attempt && backoff < maxConnectBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxConnectBackoff)
+	return backoff + rand.N(backoff/4+1)
+}
+
+// connectWithRetry connects to the server, retrying with backoff until it succeeds,
+// ctx is cancelled or maxRetries retries have failed. Zero maxRetries means no limit.
+func connectWithRetry(ctx context.Context, conn *irc.Connection, server string, maxRetries int) error {
+	for attempt := 1; ; attempt++ {
+		err := conn.Connect(server)
+		if err == nil {
+			return nil
+		}
+		if maxRetries > 0 && attempt > maxRetries {
+			return fmt.Errorf("giving up on %s after %d attempts: %w", server, attempt, err)
+		}
+
+		backoff := connectBackoff(attempt)
+		slog.Warn("Error connecting, retrying", "server", server, "attempt", attempt, "retryIn", backoff.Round(time.Second), "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped connecting to %s after %d attempts: %w", server, attempt, ctx.Err())
+		case <-defaultClock.After(backoff):
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestConnectBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 5 * time.Second},
+		{attempt: 2, want: 10 * time.Second},
+		{attempt: 3, want: 20 * time.Second},
+		{attempt: 7, want: maxConnectBackoff},
+		{attempt: 100, want: maxConnectBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want.String(), func(t *testing.T) {
+			// The jitter adds up to a quarter
+			for range 20 {
+				if got := connectBackoff(tt.attempt); got < tt.want || got > tt.want+tt.want/4 {
+					t.Fatalf("connectBackoff(%d) = %v, want %v to %v", tt.attempt, got, tt.want, tt.want+tt.want/4)
+				}
+			}
+		})
+	}
+}
+
+// closedAddress returns a local address nothing is listening on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestConnectWithRetry(t *testing.T) {
+	address := closedAddress(t)
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		clock := useInstantClock(t)
+		err := connectWithRetry(context.Background(), irc.IRC("gobot", "gobot"), address, 2)
+		if err == nil {
+			t.Fatal("connectWithRetry() succeeded without a server")
+		}
+		if len(clock.delays) != 2 {
+			t.Fatalf("waited %d times, want 2", len(clock.delays))
+		}
+		if clock.delays[1] < 2*initialConnectBackoff {
+			t.Errorf("second wait = %v, want at least %v", clock.delays[1], 2*initialConnectBackoff)
+		}
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		useInstantClock(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := connectWithRetry(ctx, irc.IRC("gobot", "gobot"), address, 0)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("connectWithRetry() = %v, want %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	registerFeature("ctcp", func(config *Config, conn *irc.Connection) {
+		setupCTCP(config, conn, connections.logger(conn))
+	})
+}
+
+// ctcpCommands are the CTCP requests the IRC library replies to, in the order CLIENTINFO lists them
+var ctcpCommands = []string{"PING", "VERSION", "TIME", "USERINFO", "CLIENTINFO"}
+
+// validateCTCP checks that only known CTCP requests are disabled.
+func validateCTCP(c CTCPConfig) error {
+	for _, name := range c.Disabled {
+		if !slices.Contains(ctcpCommands, strings.ToUpper(name)) {
+			return fmt.Errorf("unknown CTCP request in disabled list: %s", name)
+		}
+	}
+	for name := range c.Responses {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " \x01") {
+			return fmt.Errorf("invalid CTCP request name: %q", name)
+		}
+		for _, disabled := range c.Disabled {
+			if strings.EqualFold(disabled, name) {
+				return fmt.Errorf("CTCP %s is both disabled and has a custom response", name)
+			}
+		}
+	}
+	return nil
+}
+
+// expandCTCPResponse fills in the variables of a custom CTCP response template.
+func expandCTCPResponse(template string, e *irc.Event) string {
+	return strings.NewReplacer("{nick}", e.Nick, "{version}", Version).Replace(template)
+}
+
+// ctcpEnabled reports whether the bot replies to a CTCP request.
+func ctcpEnabled(config *Config, name string) bool {
+	for _, disabled := range config.CTCP.Disabled {
+		if strings.EqualFold(disabled, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTimeFormat checks that a time format contains at least one layout element,
+// otherwise it would be sent back verbatim instead of the time.
+// The sample differs from the layout reference time in every element, which would format "15:04" as "15:04".
+func validateTimeFormat(format string) error {
+	sample := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.FixedZone("", 3*60*60))
+	if sample.Format(format) == format {
+		return fmt.Errorf("time format %q has no time layout elements", format)
+	}
+	return nil
+}
+
+// ctcpTime returns the reply to a CTCP TIME request, the time in the configured format or RFC 1123.
+func ctcpTime(config *Config, now time.Time) string {
+	format := config.CTCP.TimeFormat
+	if format == "" {
+		format = time.RFC1123
+	}
+	return now.Format(format)
+}
+
+// setupCTCP replaces the CTCP replies of the IRC library with configurable ones.
+func setupCTCP(config *Config, conn *irc.Connection, logger *slog.Logger) {
+	reply := func(e *irc.Event, name, response string) {
+		logger.Debug("Answering CTCP request", "nick", e.Nick, "request", name)
+		// The reply has to fit on one line with the \x01 markers around it
+		message := splitMessage(name+" "+response, max(maxMessageBytes(conn, e.Nick)-len("\x01\x01"), 1))[0]
+		conn.SendRawf("NOTICE %s :\x01%s\x01", e.Nick, message)
+	}
+
+	var enabled []string
+	for _, name := range ctcpCommands {
+		if ctcpEnabled(config, name) {
+			enabled = append(enabled, name)
+		} else {
+			conn.ClearCallback("CTCP_" + name)
+		}
+	}
+
+	// Custom responses replace the built-in reply for requests the library knows
+	// and are matched from the generic CTCP event for everything else
+	custom := make(map[string]string)
+	overridden := make(map[string]bool)
+	for name, template := range config.CTCP.Responses {
+		name = strings.ToUpper(name)
+		if slices.Contains(ctcpCommands, name) {
+			overridden[name] = true
+			conn.ClearCallback("CTCP_" + name)
+			conn.AddCallback("CTCP_"+name, func(e *irc.Event) {
+				reply(e, name, expandCTCPResponse(template, e))
+			})
+			continue
+		}
+		custom[name] = template
+		enabled = append(enabled, name)
+	}
+	if len(custom) > 0 {
+		conn.AddCallback("CTCP", func(e *irc.Event) {
+			fields := strings.Fields(e.Message())
+			if len(fields) == 0 {
+				return
+			}
+			name := strings.ToUpper(fields[0])
+			if template, ok := custom[name]; ok {
+				reply(e, name, expandCTCPResponse(template, e))
+			}
+		})
+	}
+
+	if !overridden["CLIENTINFO"] && ctcpEnabled(config, "CLIENTINFO") {
+		// Only advertise the requests that are answered
+		conn.ClearCallback("CTCP_CLIENTINFO")
+		conn.AddCallback("CTCP_CLIENTINFO", func(e *irc.Event) {
+			reply(e, "CLIENTINFO", strings.Join(enabled, " "))
+		})
+	}
+
+	if !overridden["TIME"] && ctcpEnabled(config, "TIME") {
+		conn.ClearCallback("CTCP_TIME")
+		conn.AddCallback("CTCP_TIME", func(e *irc.Event) {
+			reply(e, "TIME", ctcpTime(config, defaultClock.Now()))
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestCTCPTime(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 9, 5, 3, 0, time.FixedZone("EEST", 3*60*60))
+
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{name: "default", want: "Wed, 14 Oct 2026 09:05:03 EEST"},
+		{name: "ISO 8601", format: time.RFC3339, want: "2026-10-14T09:05:03+03:00"},
+		{name: "custom", format: "02.01.2006 15:04 MST", want: "14.10.2026 09:05 EEST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{CTCP: CTCPConfig{TimeFormat: tt.format}}
+			if got := ctcpTime(config, now); got != tt.want {
+				t.Errorf("ctcpTime() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTimeFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{format: time.RFC1123},
+		{format: "15:04"},
+		{format: "2006"},
+		{format: "time please", wantErr: true},
+		{format: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if err := validateTimeFormat(tt.format); (err != nil) != tt.wantErr {
+				t.Errorf("validateTimeFormat(%q) error = %v, wantErr %v", tt.format, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCTCPEnabled(t *testing.T) {
+	config := &Config{CTCP: CTCPConfig{Disabled: []string{"version", "TIME"}}}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "VERSION", want: false},
+		{name: "TIME", want: false},
+		{name: "time", want: false},
+		{name: "PING", want: true},
+		{name: "CLIENTINFO", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ctcpEnabled(config, tt.name); got != tt.want {
+				t.Errorf("ctcpEnabled(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if !ctcpEnabled(&Config{}, "VERSION") {
+		t.Error("CTCP VERSION is disabled by default")
+	}
+}
+
+func TestValidateCTCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CTCPConfig
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "known requests disabled", config: CTCPConfig{Disabled: []string{"version", "PING"}}},
+		{name: "unknown request disabled", config: CTCPConfig{Disabled: []string{"FINGER"}}, wantErr: true},
+		{name: "custom responses", config: CTCPConfig{Responses: map[string]string{"SOURCE": "https://example.com", "VERSION": "gobot"}}},
+		{name: "name with a space", config: CTCPConfig{Responses: map[string]string{"MY SOURCE": "x"}}, wantErr: true},
+		{name: "name with a CTCP marker", config: CTCPConfig{Responses: map[string]string{"SOURCE\x01": "x"}}, wantErr: true},
+		{name: "blank name", config: CTCPConfig{Responses: map[string]string{" ": "x"}}, wantErr: true},
+		{
+			name:    "disabled request with a response",
+			config:  CTCPConfig{Disabled: []string{"version"}, Responses: map[string]string{"VERSION": "gobot"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCTCP(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validateCTCP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandCTCPResponse(t *testing.T) {
+	e := &irc.Event{Nick: "someone"}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{template: "https://github.com/lepinkainen/gobotlite", want: "https://github.com/lepinkainen/gobotlite"},
+		{template: "Hello {nick}", want: "Hello someone"},
+		{template: "gobotlite {version}", want: "gobotlite " + Version},
+		{template: "{unknown}", want: "{unknown}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if got := expandCTCPResponse(tt.template, e); got != tt.want {
+				t.Errorf("expandCTCPResponse(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
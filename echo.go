@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	// The server sends the bot's own messages back to it, confirming they were delivered
+	wantCap("echo-message")
+
+	registerFeature("echo", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("PRIVMSG", func(e *irc.Event) {
+			if isEcho(conn, e) && len(e.Arguments) > 0 {
+				slog.Debug("Message delivered", "target", e.Arguments[0])
+			}
+		})
+	})
+}
+
+// isEcho reports whether a message was sent by the bot itself, which happens with echo-message.
+func isEcho(conn *irc.Connection, e *irc.Event) bool {
+	return strings.EqualFold(e.Nick, botNick(conn))
+}
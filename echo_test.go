@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestIsEcho(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	currentNicks.set(conn, "gobot_")
+	t.Cleanup(func() { currentNicks.remove(conn) })
+
+	tests := []struct {
+		nick string
+		want bool
+	}{
+		{nick: "gobot_", want: true},
+		{nick: "GoBot_", want: true},
+		// The configured nick isn't the bot while it's using another one
+		{nick: "gobot", want: false},
+		{nick: "alice", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nick, func(t *testing.T) {
+			if got := isEcho(conn, &irc.Event{Code: "PRIVMSG", Nick: tt.nick}); got != tt.want {
+				t.Errorf("isEcho() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEchoedMessagesAreNotHandled(t *testing.T) {
+	conn := newNetworkConn(t)
+	before := messageStats.get(conn, "#echo")
+
+	handlePrivmsg(&Config{}, conn, discardLogger, &irc.Event{Code: "PRIVMSG", Nick: "gobot", Arguments: []string{"#echo", "hello there"}})
+	if got := messageStats.get(conn, "#echo"); got != before {
+		t.Errorf("echoed message was counted: %+v, before %+v", got, before)
+	}
+
+	handlePrivmsg(&Config{}, conn, discardLogger, &irc.Event{Code: "PRIVMSG", Nick: "alice", Arguments: []string{"#echo", "hello there"}})
+	if got := messageStats.get(conn, "#echo"); got.Received != before.Received+1 {
+		t.Errorf("received = %d, want %d", got.Received, before.Received+1)
+	}
+}
+
+func TestEchoMessageWanted(t *testing.T) {
+	if !isWantedCap("echo-message") {
+		t.Error("echo-message is not requested")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// Bot level events features can subscribe to
+const (
+	// EventConnected fires when the server has accepted the registration (001)
+	EventConnected = "CONNECTED"
+	// EventDisconnected fires when the server closes the link with an ERROR message.
+	// conn.Loop handles reconnecting internally, so disconnects without an ERROR aren't seen.
+	EventDisconnected = "DISCONNECTED"
+	// EventJoin fires when the bot itself has joined a channel
+	EventJoin = "JOIN"
+	// EventClosed fires when the bot is done with a connection, e.g. before its network is restarted,
+	// so features can forget what they kept for it. There is no IRC event, e is nil.
+	EventClosed = "CLOSED"
+)
+
+// eventHandler receives a bot event and the IRC event that caused it.
+type eventHandler func(config *Config, conn *irc.Connection, e *irc.Event)
+
+var (
+	subscribersMutex sync.Mutex
+	subscribers      = map[string][]eventHandler{}
+)
+
+func init() {
+	registerFeature("events", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("001", func(e *irc.Event) {
+			handleWelcome(config, conn, e)
+		})
+		conn.AddCallback("ERROR", func(e *irc.Event) {
+			publish(EventDisconnected, config, conn, e)
+		})
+		conn.AddCallback("JOIN", func(e *irc.Event) {
+			if strings.EqualFold(e.Nick, botNick(conn)) {
+				publish(EventJoin, config, conn, e)
+			}
+		})
+	})
+}
+
+// handleWelcome runs the steps after registration in order: the subscribers of EventConnected reset
+// their state for the new connection and ask for capabilities, then the bot identifies to services
+// and joins its channels once the capabilities are negotiated.
+// Doing this in separate 001 callbacks would run them concurrently.
+// 001: RPL_WELCOME "<client> :Welcome to the Internet Relay Network <nick>!<user>@<host>"
+func handleWelcome(config *Config, conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) > 0 {
+		connections.logger(conn).Info("Registered", "nick", e.Arguments[0])
+	}
+	publish(EventConnected, config, conn, e)
+	// Identify before joining so channels that require it can be joined
+	identifyNick(config, conn)
+	// The answers to CAP come in on this connection's read loop, so this can't wait for them here
+	caps.afterNegotiation(conn, capNegotiationTimeout, func() {
+		joinConfiguredChannels(config, conn)
+	})
+}
+
+// subscribe registers a handler for a bot event, features call this from init().
+func subscribe(event string, handler eventHandler) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	subscribers[event] = append(subscribers[event], handler)
+}
+
+// publish calls every handler subscribed to the event in registration order.
+func publish(event string, config *Config, conn *irc.Connection, e *irc.Event) {
+	subscribersMutex.Lock()
+	handlers := append([]eventHandler{}, subscribers[event]...)
+	subscribersMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(config, conn, e)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// useSubscribers replaces the registered subscribers for the duration of the test.
+func useSubscribers(t *testing.T) {
+	t.Helper()
+	subscribersMutex.Lock()
+	saved := subscribers
+	subscribers = map[string][]eventHandler{}
+	subscribersMutex.Unlock()
+	t.Cleanup(func() {
+		subscribersMutex.Lock()
+		subscribers = saved
+		subscribersMutex.Unlock()
+	})
+}
+
+func TestPublish(t *testing.T) {
+	useSubscribers(t)
+
+	var got []string
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		got = append(got, "first "+e.Code)
+	})
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		got = append(got, "second "+e.Code)
+	})
+	subscribe(EventDisconnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		got = append(got, "disconnected")
+	})
+
+	publish(EventConnected, &Config{}, irc.IRC("gobot", "gobot"), &irc.Event{Code: "001"})
+	if want := []string{"first 001", "second 001"}; !slices.Equal(got, want) {
+		t.Errorf("handlers ran as %v, want %v", got, want)
+	}
+
+	got = nil
+	publish(EventJoin, &Config{}, irc.IRC("gobot", "gobot"), &irc.Event{Code: "JOIN"})
+	if len(got) != 0 {
+		t.Errorf("handlers of other events ran: %v", got)
+	}
+}
+
+func TestJoinEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		nick string
+		want bool
+	}{
+		{name: "bot joins", nick: "gobot", want: true},
+		{name: "bot joins with another case", nick: "GoBot", want: true},
+		{name: "someone else joins", nick: "other", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useSubscribers(t)
+			published := false
+			subscribe(EventJoin, func(config *Config, conn *irc.Connection, e *irc.Event) {
+				published = true
+			})
+
+			conn := irc.IRC("gobot", "gobot")
+			for _, f := range features {
+				if f.name == "events" {
+					f.setup(&Config{}, conn)
+				}
+			}
+			conn.RunCallbacks(&irc.Event{Code: "JOIN", Nick: tt.nick, Arguments: []string{"#gobot"}})
+
+			if published != tt.want {
+				t.Errorf("EventJoin published = %v, want %v", published, tt.want)
+			}
+		})
+	}
+}
+
+// newServerConn returns a connection registered as the libera network, connected to a fake server
+// that only collects the lines the bot sends after registering.
+func newServerConn(t *testing.T) (*irc.Connection, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if socket, err := listener.Accept(); err == nil {
+			accepted <- socket
+		}
+		close(accepted)
+	}()
+
+	conn := irc.IRC("gobot", "gobot")
+	conn.Log = log.New(io.Discard, "", 0)
+	if err := conn.Connect(listener.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	socket := <-accepted
+	listener.Close()
+	if socket == nil {
+		t.Fatal("connection was not accepted")
+	}
+	connections.add("libera", conn, slog.Default())
+	t.Cleanup(func() {
+		connections.remove(conn)
+		// The read loop only stops once the server hangs up
+		socket.Close()
+		conn.Disconnect()
+	})
+
+	lines := make(chan string, 100)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(socket)
+		for scanner.Scan() {
+			if line := scanner.Text(); !strings.HasPrefix(line, "NICK ") && !strings.HasPrefix(line, "USER ") {
+				lines <- line
+			}
+		}
+	}()
+	return conn, lines
+}
+
+// nextLine returns the next line sent to the server, failing the test if none comes.
+func nextLine(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(time.Second):
+		t.Fatal("no line was sent")
+		return ""
+	}
+}
+
+// sentLines returns the lines sent to the server since the last call, marking their end with a line of its own.
+func sentLines(t *testing.T, conn *irc.Connection, lines <-chan string) []string {
+	t.Helper()
+	conn.SendRaw("END")
+	var got []string
+	for line := nextLine(t, lines); line != "END"; line = nextLine(t, lines) {
+		got = append(got, line)
+	}
+	return got
+}
+
+func TestHandleWelcome(t *testing.T) {
+	useSubscribers(t)
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		conn.SendRaw("CONNECTED")
+	})
+
+	tests := []struct {
+		name    string
+		network Network
+		want    []string
+	}{
+		{
+			name:    "channels only",
+			network: Network{Channels: []string{"go", "#rust"}},
+			want:    []string{"CONNECTED", "JOIN #go", "JOIN #rust"},
+		},
+		{
+			name:    "identifies before joining",
+			network: Network{Nickname: "gobot", Channels: []string{"#go"}, NickServ: "NickServ", NickServPassword: "secret"},
+			want:    []string{"CONNECTED", "PRIVMSG NickServ :IDENTIFY gobot secret", "JOIN #go"},
+		},
+		{
+			name:    "no password",
+			network: Network{Channels: []string{"#go"}, NickServ: "NickServ"},
+			want:    []string{"CONNECTED", "JOIN #go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, lines := newServerConn(t)
+			config := &Config{Networks: map[string]Network{"libera": tt.network}}
+
+			handleWelcome(config, conn, &irc.Event{Code: "001", Arguments: []string{"gobot", "Welcome"}})
+			t.Cleanup(func() { caps.remove(conn) })
+			// The server offers nothing the bot wants, which ends the negotiation
+			handleCap(conn, &irc.Event{Code: "CAP", Arguments: []string{"gobot", "LS", "sasl"}})
+			if got := sentLines(t, conn, lines); !slices.Equal(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
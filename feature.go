@@ -0,0 +1,26 @@
+package main
+
+import (
+	irc "github.com/thoj/go-ircevent"
+)
+
+// feature is a self-contained part of the bot that hooks into every IRC connection.
+type feature struct {
+	name  string
+	setup func(config *Config, conn *irc.Connection)
+}
+
+// features are set up in registration order on every new connection
+var features []feature
+
+// registerFeature adds a feature to be set up on every connection, features call this from init().
+func registerFeature(name string, setup func(config *Config, conn *irc.Connection)) {
+	features = append(features, feature{name: name, setup: setup})
+}
+
+// setupFeatures wires all registered features into a connection.
+func setupFeatures(config *Config, conn *irc.Connection) {
+	for _, f := range features {
+		f.setup(config, conn)
+	}
+}
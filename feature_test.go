@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestFeaturesRegistered(t *testing.T) {
+	var names []string
+	for _, f := range features {
+		names = append(names, f.name)
+	}
+
+	for _, want := range []string{"events", "privmsg", "title", "ctcp", "nick", "kick", "members", "relay", "remind", "sender"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("feature %q is not registered, have %v", want, names)
+		}
+	}
+}
+
+func TestCommandsRegistered(t *testing.T) {
+	for _, want := range []string{"version", "uptime", "source", "note", "notes", "kicks", "stats", "access", "ignore", "unignore", "say", "remindall", "op", "deop", "chanserv", "config"} {
+		if _, ok := localCommands[want]; !ok {
+			t.Errorf("command %q is not registered", want)
+		}
+	}
+}
+
+func TestSetupFeatures(t *testing.T) {
+	saved := features
+	t.Cleanup(func() { features = saved })
+	features = nil
+
+	var order []string
+	registerFeature("first", func(config *Config, conn *irc.Connection) { order = append(order, "first") })
+	registerFeature("second", func(config *Config, conn *irc.Connection) { order = append(order, "second") })
+
+	setupFeatures(&Config{}, irc.IRC("gobot", "gobot"))
+	if !slices.Equal(order, []string{"first", "second"}) {
+		t.Errorf("features were set up in order %v, want [first second]", order)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// IRC formatting control codes
+const (
+	ircBold      = "\x02"
+	ircUnderline = "\x1f"
+)
+
+var (
+	boldMarkup      = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	underlineMarkup = regexp.MustCompile(`__(.+?)__`)
+)
+
+func init() {
+	registerAdminCommand("say", sayCommand)
+}
+
+// stripControl removes every control character, including raw IRC formatting codes,
+// CTCP delimiters and line breaks that could be used to inject protocol commands.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// sanitizeMessage makes text safe to send as a single message: line breaks and tabs become spaces,
+// NUL bytes are dropped and runs of spaces are collapsed. Formatting codes are left alone.
+// A line break in a message would end the PRIVMSG and let the rest be sent as a raw IRC command.
+func sanitizeMessage(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '\r', '\n', '\t':
+			return ' '
+		case 0:
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// renderMarkup strips control characters from s and then turns **bold** and __underline__ into IRC formatting.
+func renderMarkup(s string) string {
+	s = stripControl(s)
+	s = boldMarkup.ReplaceAllString(s, ircBold+"$1"+ircBold)
+	s = underlineMarkup.ReplaceAllString(s, ircUnderline+"$1"+ircUnderline)
+	return s
+}
+
+// sayCommand handles ".say <text>" by repeating the text with markup rendered.
+func sayCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: say <text>, **bold** and __underline__ are supported", nil
+	}
+	return renderMarkup(strings.Join(args, " ")), nil
+}
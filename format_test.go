@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestRenderMarkup(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain text", in: "hello world", want: "hello world"},
+		{name: "bold", in: "**hello** world", want: ircBold + "hello" + ircBold + " world"},
+		{name: "underline", in: "hello __world__", want: "hello " + ircUnderline + "world" + ircUnderline},
+		{name: "both", in: "**a** __b__", want: ircBold + "a" + ircBold + " " + ircUnderline + "b" + ircUnderline},
+		{name: "unclosed markup", in: "**hello", want: "**hello"},
+		{name: "empty markup", in: "****", want: "****"},
+		{name: "raw formatting codes are stripped", in: "\x02bold\x02 \x0304red\x03", want: "bold 04red"},
+		{name: "line break injection", in: "hi\r\nQUIT :bye", want: "hiQUIT :bye"},
+		{name: "CTCP injection", in: "\x01ACTION dances\x01", want: "ACTION dances"},
+		{name: "stripped before rendering", in: "**\x02x\x02**", want: ircBold + "x" + ircBold},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMarkup(tt.in); got != tt.want {
+				t.Errorf("renderMarkup(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain text", in: "hello world", want: "hello world"},
+		{name: "line break injection", in: "hi\r\nQUIT :bye", want: "hi QUIT :bye"},
+		{name: "bare newline", in: "one\ntwo", want: "one two"},
+		{name: "tabs", in: "a\tb", want: "a b"},
+		{name: "NUL bytes", in: "a\x00b", want: "ab"},
+		{name: "runs of spaces", in: "  a   b  ", want: "a b"},
+		{name: "formatting codes are kept", in: ircBold + "bold" + ircBold + " \x0304red\x03", want: ircBold + "bold" + ircBold + " \x0304red\x03"},
+		{name: "only whitespace", in: "\r\n\t ", want: ""},
+		{name: "empty", in: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeMessage(tt.in); got != tt.want {
+				t.Errorf("sanitizeMessage(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,10 +4,9 @@ go 1.23
 
 require (
 	github.com/thoj/go-ircevent v0.0.0-20210723090443-73e444401d64
+	golang.org/x/text v0.21.0
+	golang.org/x/time v0.8.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
-require (
-	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
-)
+require golang.org/x/net v0.33.0 // indirect
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// connectTimes records when each connection last finished registering.
+type connectTimes struct {
+	sync.Mutex
+	clock Clock
+	times map[*irc.Connection]time.Time
+}
+
+var connectedAt = &connectTimes{clock: defaultClock, times: make(map[*irc.Connection]time.Time)}
+
+func init() {
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		connectedAt.set(conn, connectedAt.clock.Now())
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		connectedAt.remove(conn)
+	})
+}
+
+func (c *connectTimes) set(conn *irc.Connection, t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.times[conn] = t
+}
+
+func (c *connectTimes) remove(conn *irc.Connection) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.times, conn)
+}
+
+func (c *connectTimes) get(conn *irc.Connection) time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.times[conn]
+}
+
+// inStartupGrace reports whether the connection registered less than the configured grace period ago.
+// Commands and titles are ignored during it so the bot doesn't act before it has joined and identified.
+func inStartupGrace(config *Config, conn *irc.Connection) bool {
+	grace := time.Duration(config.StartupGrace)
+	if grace <= 0 {
+		return false
+	}
+	return connectedAt.clock.Now().Sub(connectedAt.get(conn)) < grace
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestInStartupGrace(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	previous := connectedAt.clock
+	connectedAt.clock = clock
+	t.Cleanup(func() { connectedAt.clock = previous })
+
+	tests := []struct {
+		name      string
+		grace     time.Duration
+		connected bool
+		elapsed   time.Duration
+		want      bool
+	}{
+		{name: "just connected", grace: 10 * time.Second, connected: true, want: true},
+		{name: "within the grace period", grace: 10 * time.Second, connected: true, elapsed: 9 * time.Second, want: true},
+		{name: "grace period over", grace: 10 * time.Second, connected: true, elapsed: 10 * time.Second, want: false},
+		{name: "no grace period", connected: true, want: false},
+		{name: "never connected", grace: 10 * time.Second, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := irc.IRC("gobot", "gobot")
+			config := &Config{StartupGrace: Duration(tt.grace)}
+			if tt.connected {
+				connectedAt.set(conn, clock.Now())
+			}
+			t.Cleanup(func() { connectedAt.remove(conn) })
+
+			clock.now = clock.now.Add(tt.elapsed)
+			if got := inStartupGrace(config, conn); got != tt.want {
+				t.Errorf("inStartupGrace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	registerFeature("invite", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("INVITE", func(e *irc.Event) {
+			handleInvite(config, conn, e)
+		})
+	})
+}
+
+// validateInvitePatterns checks that the invite patterns are valid globs.
+func validateInvitePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid invite pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesInvitePattern reports whether the channel matches one of the glob patterns, ignoring case.
+func matchesInvitePattern(channel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(channel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInvite joins channels the bot is invited to if they match the invite patterns of the network.
+func handleInvite(config *Config, conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) < 2 {
+		return
+	}
+	channel := e.Arguments[1]
+
+	network := config.Networks[connections.name(conn)]
+	if !matchesInvitePattern(channel, network.InviteChannels) {
+		slog.Info("Ignoring invite", "channel", channel, "from", e.Nick)
+		return
+	}
+
+	slog.Info("Joining on invite", "channel", channel, "from", e.Nick)
+	joinChannel(config, conn, channel)
+}
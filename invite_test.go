@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestMatchesInvitePattern(t *testing.T) {
+	patterns := []string{"#project-*", "#exact", "#team-?"}
+
+	tests := []struct {
+		channel string
+		want    bool
+	}{
+		{channel: "#project-gobot", want: true},
+		{channel: "#project-", want: true},
+		{channel: "#PROJECT-Gobot", want: true},
+		{channel: "#exact", want: true},
+		{channel: "#exactly", want: false},
+		{channel: "#team-a", want: true},
+		{channel: "#team-ab", want: false},
+		{channel: "#other", want: false},
+		{channel: "##project-gobot", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			if got := matchesInvitePattern(tt.channel, patterns); got != tt.want {
+				t.Errorf("matchesInvitePattern(%q) = %v, want %v", tt.channel, got, tt.want)
+			}
+		})
+	}
+
+	if matchesInvitePattern("#project-gobot", nil) {
+		t.Error("invites are accepted without patterns")
+	}
+}
+
+func TestValidateInvitePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		wantErr  bool
+	}{
+		{name: "none"},
+		{name: "valid", patterns: []string{"#project-*", "#team-[ab]"}},
+		{name: "unclosed class", patterns: []string{"#ok-*", "#team-[ab"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateInvitePatterns(tt.patterns); (err != nil) != tt.wantErr {
+				t.Errorf("validateInvitePatterns(%q) error = %v, wantErr %v", tt.patterns, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// Defaults for servers that don't advertise a parameter, from RFC 2812
+const (
+	defaultChanTypes = "#&"
+	defaultPrefix    = "(ov)@+"
+	defaultChanModes = "beI,k,l,imnpst"
+)
+
+// isupportStore keeps the RPL_ISUPPORT (005) parameters each server has advertised.
+type isupportStore struct {
+	sync.Mutex
+	// connection -> parameter -> value, parameters without a value map to ""
+	params map[*irc.Connection]map[string]string
+}
+
+var isupport = &isupportStore{params: make(map[*irc.Connection]map[string]string)}
+
+func init() {
+	// The parameters are sent again after every registration
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		isupport.reset(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		isupport.reset(conn)
+	})
+
+	registerFeature("isupport", func(config *Config, conn *irc.Connection) {
+		// 005: RPL_ISUPPORT "<nick> <token>... :are supported by this server"
+		conn.AddCallback("005", func(e *irc.Event) {
+			if len(e.Arguments) < 3 {
+				return
+			}
+			isupport.update(conn, e.Arguments[1:len(e.Arguments)-1])
+		})
+	})
+}
+
+// parseISupportToken splits a single 005 token into its name and value.
+// A leading "-" means the parameter was withdrawn by the server.
+func parseISupportToken(token string) (name, value string, negated bool) {
+	if strings.HasPrefix(token, "-") {
+		return strings.ToUpper(token[1:]), "", true
+	}
+	name, value, _ = strings.Cut(token, "=")
+	return strings.ToUpper(name), unescapeISupportValue(value), false
+}
+
+// unescapeISupportValue decodes the \xHH escapes allowed in 005 values.
+func unescapeISupportValue(value string) string {
+	if !strings.Contains(value, `\x`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if c, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+func (s *isupportStore) reset(conn *irc.Connection) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.params, conn)
+}
+
+// update applies the tokens of one 005 line.
+func (s *isupportStore) update(conn *irc.Connection, tokens []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	params, ok := s.params[conn]
+	if !ok {
+		params = make(map[string]string)
+		s.params[conn] = params
+	}
+	for _, token := range tokens {
+		name, value, negated := parseISupportToken(token)
+		if negated {
+			delete(params, name)
+		} else if name != "" {
+			params[name] = value
+		}
+	}
+}
+
+// get returns the value of a parameter and whether the server advertised it.
+func (s *isupportStore) get(conn *irc.Connection, name string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	value, ok := s.params[conn][name]
+	return value, ok
+}
+
+// chanTypes returns the channel prefix characters of the server.
+func chanTypes(conn *irc.Connection) string {
+	if value, ok := isupport.get(conn, "CHANTYPES"); ok && value != "" {
+		return value
+	}
+	return defaultChanTypes
+}
+
+// prefixSymbols returns the channel membership modes and their symbols, e.g. "ov" and "@+".
+func prefixSymbols(conn *irc.Connection) (modes, symbols string) {
+	value, ok := isupport.get(conn, "PREFIX")
+	if !ok {
+		value = defaultPrefix
+	}
+	if !strings.HasPrefix(value, "(") || !strings.Contains(value, ")") {
+		// An empty PREFIX means the server has no membership prefixes
+		return "", ""
+	}
+	modes, symbols, _ = strings.Cut(value[1:], ")")
+	if len(modes) != len(symbols) {
+		return "", ""
+	}
+	return modes, symbols
+}
+
+// isupportInt returns a numeric parameter, or 0 if it's missing or not a number.
+func isupportInt(conn *irc.Connection, name string) int {
+	value, ok := isupport.get(conn, name)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// chanModes returns the channel modes of the server by type: modes with a list parameter,
+// modes that always have a parameter, modes with a parameter only when set and modes without one.
+func chanModes(conn *irc.Connection) (list, always, whenSet, never string) {
+	value, ok := isupport.get(conn, "CHANMODES")
+	if !ok {
+		value = defaultChanModes
+	}
+	types := append(strings.SplitN(value, ",", 4), "", "", "")
+	return types[0], types[1], types[2], types[3]
+}
+
+// targMax returns how many targets the server accepts in one command, 0 meaning no limit.
+// TARGMAX lists the limits per command, e.g. "PRIVMSG:4,NOTICE:4,JOIN:", an empty limit is unlimited.
+// Older servers only advertise MAXTARGETS, servers with neither get one target at a time.
+func targMax(conn *irc.Connection, command string) int {
+	if value, ok := isupport.get(conn, "TARGMAX"); ok {
+		for _, entry := range strings.Split(value, ",") {
+			name, limit, _ := strings.Cut(entry, ":")
+			if !strings.EqualFold(name, command) {
+				continue
+			}
+			if limit == "" {
+				return 0
+			}
+			if n, err := strconv.Atoi(limit); err == nil && n > 0 {
+				return n
+			}
+			return 1
+		}
+		return 1
+	}
+	if n := isupportInt(conn, "MAXTARGETS"); n > 0 {
+		return n
+	}
+	return 1
+}
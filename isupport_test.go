@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// newISupportConn returns a connection whose server advertised the tokens.
+func newISupportConn(t *testing.T, tokens ...string) *irc.Connection {
+	t.Helper()
+	conn := irc.IRC("gobot", "gobot")
+	if len(tokens) > 0 {
+		isupport.update(conn, tokens)
+	}
+	t.Cleanup(func() { isupport.reset(conn) })
+	return conn
+}
+
+func TestParseISupportToken(t *testing.T) {
+	tests := []struct {
+		token       string
+		wantName    string
+		wantValue   string
+		wantNegated bool
+	}{
+		{token: "CHANTYPES=#", wantName: "CHANTYPES", wantValue: "#"},
+		{token: "PREFIX=(qaohv)~&@%+", wantName: "PREFIX", wantValue: "(qaohv)~&@%+"},
+		{token: "EXCEPTS", wantName: "EXCEPTS", wantValue: ""},
+		{token: "SAFELIST=", wantName: "SAFELIST", wantValue: ""},
+		{token: "nicklen=30", wantName: "NICKLEN", wantValue: "30"},
+		{token: "-EXCEPTS", wantName: "EXCEPTS", wantNegated: true},
+		{token: `NETWORK=Example\x20Net`, wantName: "NETWORK", wantValue: "Example Net"},
+		{token: "CHANMODES=beI,k,l,imnpst", wantName: "CHANMODES", wantValue: "beI,k,l,imnpst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			name, value, negated := parseISupportToken(tt.token)
+			if name != tt.wantName || value != tt.wantValue || negated != tt.wantNegated {
+				t.Errorf("parseISupportToken(%q) = %q, %q, %v, want %q, %q, %v",
+					tt.token, name, value, negated, tt.wantName, tt.wantValue, tt.wantNegated)
+			}
+		})
+	}
+}
+
+func TestUnescapeISupportValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "plain", want: "plain"},
+		{value: `a\x20b`, want: "a b"},
+		{value: `\x3D\x5C`, want: `=\`},
+		{value: `trailing\x2`, want: `trailing\x2`},
+		{value: `bad\xZZ`, want: `bad\xZZ`},
+		{value: `end\x41`, want: "endA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := unescapeISupportValue(tt.value); got != tt.want {
+				t.Errorf("unescapeISupportValue(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestISupportUpdate(t *testing.T) {
+	conn := newISupportConn(t, "CHANTYPES=#", "EXCEPTS", "NICKLEN=16")
+	isupport.update(conn, []string{"-EXCEPTS", "NICKLEN=30"})
+
+	if value, ok := isupport.get(conn, "CHANTYPES"); !ok || value != "#" {
+		t.Errorf("CHANTYPES = %q, %v, want #, true", value, ok)
+	}
+	if _, ok := isupport.get(conn, "EXCEPTS"); ok {
+		t.Error("withdrawn EXCEPTS is still advertised")
+	}
+	if n := isupportInt(conn, "NICKLEN"); n != 30 {
+		t.Errorf("NICKLEN = %d, want 30", n)
+	}
+
+	isupport.reset(conn)
+	if _, ok := isupport.get(conn, "CHANTYPES"); ok {
+		t.Error("CHANTYPES is still advertised after a reset")
+	}
+}
+
+func TestISupportCallback(t *testing.T) {
+	conn := newISupportConn(t)
+	for _, f := range features {
+		if f.name == "isupport" {
+			f.setup(&Config{}, conn)
+		}
+	}
+	conn.RunCallbacks(&irc.Event{Code: "005", Arguments: []string{"gobot", "CHANTYPES=#&", "NICKLEN=30", "are supported by this server"}})
+
+	if got := chanTypes(conn); got != "#&" {
+		t.Errorf("chanTypes() = %q, want #&", got)
+	}
+	if _, ok := isupport.get(conn, "ARE SUPPORTED BY THIS SERVER"); ok {
+		t.Error("the trailing text was parsed as a token")
+	}
+}
+
+func TestChanTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		want   string
+	}{
+		{name: "default", want: defaultChanTypes},
+		{name: "advertised", tokens: []string{"CHANTYPES=#"}, want: "#"},
+		{name: "empty value", tokens: []string{"CHANTYPES="}, want: defaultChanTypes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chanTypes(newISupportConn(t, tt.tokens...)); got != tt.want {
+				t.Errorf("chanTypes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixSymbols(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokens      []string
+		wantModes   string
+		wantSymbols string
+	}{
+		{name: "default", wantModes: "ov", wantSymbols: "@+"},
+		{name: "advertised", tokens: []string{"PREFIX=(qaohv)~&@%+"}, wantModes: "qaohv", wantSymbols: "~&@%+"},
+		{name: "no prefixes", tokens: []string{"PREFIX="}, wantModes: "", wantSymbols: ""},
+		{name: "mismatched", tokens: []string{"PREFIX=(ov)@"}, wantModes: "", wantSymbols: ""},
+		{name: "malformed", tokens: []string{"PREFIX=@+"}, wantModes: "", wantSymbols: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modes, symbols := prefixSymbols(newISupportConn(t, tt.tokens...))
+			if modes != tt.wantModes || symbols != tt.wantSymbols {
+				t.Errorf("prefixSymbols() = %q, %q, want %q, %q", modes, symbols, tt.wantModes, tt.wantSymbols)
+			}
+		})
+	}
+}
+
+func TestISupportInt(t *testing.T) {
+	conn := newISupportConn(t, "NICKLEN=30", "CHANNELLEN=", "TOPICLEN=long")
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{name: "NICKLEN", want: 30},
+		{name: "CHANNELLEN", want: 0},
+		{name: "TOPICLEN", want: 0},
+		{name: "LINELEN", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isupportInt(conn, tt.name); got != tt.want {
+				t.Errorf("isupportInt(%s) = %d, want %d", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargMax(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		want   int
+	}{
+		{name: "not advertised", want: 1},
+		{name: "limit", tokens: []string{"TARGMAX=NAMES:1,privmsg:4,NOTICE:4"}, want: 4},
+		{name: "unlimited", tokens: []string{"TARGMAX=JOIN:,PRIVMSG:"}, want: 0},
+		{name: "command not listed", tokens: []string{"TARGMAX=JOIN:,NOTICE:4"}, want: 1},
+		{name: "bad limit", tokens: []string{"TARGMAX=PRIVMSG:many"}, want: 1},
+		{name: "MAXTARGETS", tokens: []string{"MAXTARGETS=3"}, want: 3},
+		{name: "TARGMAX wins", tokens: []string{"MAXTARGETS=3", "TARGMAX=PRIVMSG:2"}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newISupportConn(t, tt.tokens...)
+			if got := targMax(conn, "PRIVMSG"); got != tt.want {
+				t.Errorf("targMax(PRIVMSG) = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	// inviteJoinDelay is how long to wait for ChanServ to send the invite before joining again
+	inviteJoinDelay = 5 * time.Second
+	// maxInviteRequests is how many invites are requested for a channel within inviteRequestWindow
+	maxInviteRequests   = 3
+	inviteRequestWindow = 10 * time.Minute
+	// defaultJoinTimeout is how long to wait for a join to be confirmed by default
+	defaultJoinTimeout = 30 * time.Second
+)
+
+// inviteRequests keeps the bot from looping when ChanServ won't invite it
+var inviteRequests = newWindowLimiter(inviteRequestWindow)
+
+// banList tracks the channels each connection is banned from, so they aren't retried.
+type banList struct {
+	sync.Mutex
+	// connection -> lowercase channel
+	channels map[*irc.Connection]map[string]bool
+}
+
+var bans = &banList{channels: make(map[*irc.Connection]map[string]bool)}
+
+// pendingJoin is a join the server hasn't confirmed yet.
+type pendingJoin struct {
+	attempts int
+	timer    Timer
+}
+
+// joinTracker follows the joins waiting for the end of the names list (366) that confirms them.
+type joinTracker struct {
+	sync.Mutex
+	clock Clock
+	// connection -> lowercase channel
+	pending map[*irc.Connection]map[string]*pendingJoin
+}
+
+var joins = &joinTracker{clock: defaultClock, pending: make(map[*irc.Connection]map[string]*pendingJoin)}
+
+func init() {
+	// Bans may have been lifted while the bot was away, so every registration tries once more
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		bans.reset(conn)
+		joins.reset(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		bans.reset(conn)
+		joins.reset(conn)
+	})
+	subscribe(EventJoin, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		bans.remove(conn, e.Message())
+	})
+
+	registerFeature("join", func(config *Config, conn *irc.Connection) {
+		// 366: RPL_ENDOFNAMES "<client> <channel> :End of /NAMES list"
+		conn.AddCallback("366", func(e *irc.Event) {
+			if len(e.Arguments) > 1 {
+				joins.done(conn, e.Arguments[1])
+			}
+		})
+		// 474: ERR_BANNEDFROMCHAN "<client> <channel> :Cannot join channel (+b)"
+		conn.AddCallback("474", func(e *irc.Event) {
+			handleBanned(conn, e)
+		})
+		// 473: ERR_INVITEONLYCHAN "<client> <channel> :Cannot join channel (+i)"
+		conn.AddCallback("473", func(e *irc.Event) {
+			handleInviteOnly(config, conn, e)
+		})
+	})
+}
+
+// isConfiguredChannel reports whether a channel is one of the channels configured for the connection's network.
+func isConfiguredChannel(config *Config, conn *irc.Connection, channel string) bool {
+	network := config.Networks[connections.name(conn)]
+	for _, configured := range network.Channels {
+		if strings.EqualFold(normalizeChannel(conn, configured), channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInviteOnly asks ChanServ for an invite to a configured invite-only channel and joins again.
+func handleInviteOnly(config *Config, conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) < 2 {
+		return
+	}
+	channel := e.Arguments[1]
+	if !isConfiguredChannel(config, conn, channel) {
+		slog.Warn("Cannot join invite-only channel", "channel", channel)
+		return
+	}
+
+	key := connections.name(conn) + " " + strings.ToLower(channel)
+	if allowed, first := inviteRequests.allow(key, maxInviteRequests); !allowed {
+		if first {
+			slog.Error("Cannot join invite-only channel, giving up for now", "channel", channel)
+		}
+		return
+	}
+
+	if !sendChanServ(config, conn, "INVITE", channel, botNick(conn)) {
+		slog.Warn("Cannot join invite-only channel and ChanServ is not configured", "channel", channel)
+		return
+	}
+
+	defaultClock.AfterFunc(inviteJoinDelay, func() {
+		if !members.isOn(conn, channel) && !bans.has(conn, channel) {
+			slog.Info("Joining invite-only channel again", "channel", channel)
+			joinChannel(config, conn, channel)
+		}
+	})
+}
+
+func (b *banList) reset(conn *irc.Connection) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.channels, conn)
+}
+
+func (b *banList) add(conn *irc.Connection, channel string) {
+	b.Lock()
+	defer b.Unlock()
+	if b.channels[conn] == nil {
+		b.channels[conn] = make(map[string]bool)
+	}
+	b.channels[conn][strings.ToLower(channel)] = true
+}
+
+func (b *banList) remove(conn *irc.Connection, channel string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.channels[conn], strings.ToLower(channel))
+}
+
+// has reports whether the bot is known to be banned from a channel.
+func (b *banList) has(conn *irc.Connection, channel string) bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.channels[conn][strings.ToLower(channel)]
+}
+
+// handleBanned stops rejoining a channel the bot is banned from until the next reconnect.
+// It's logged as an error so networks with a log channel alert whoever is watching it.
+func handleBanned(conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) < 2 {
+		return
+	}
+	channel := e.Arguments[1]
+	if bans.has(conn, channel) {
+		return
+	}
+	bans.add(conn, channel)
+	slog.Error("Banned from channel, not trying to join it again until reconnected", "channel", channel)
+}
+
+// joinConfiguredChannels joins the channels configured for the connection's network.
+func joinConfiguredChannels(config *Config, conn *irc.Connection) {
+	for _, channel := range config.Networks[connections.name(conn)].Channels {
+		// Default to #channels
+		joinChannel(config, conn, normalizeChannel(conn, channel))
+	}
+}
+
+// joinChannel joins a channel and, if join retries are configured, joins again when the server doesn't confirm it in time.
+func joinChannel(config *Config, conn *irc.Connection, channel string) {
+	conn.Join(channel)
+	if config.JoinRetries > 0 {
+		joins.start(config, conn, channel)
+	}
+}
+
+func (j *joinTracker) reset(conn *irc.Connection) {
+	j.Lock()
+	defer j.Unlock()
+	for _, join := range j.pending[conn] {
+		join.timer.Stop()
+	}
+	delete(j.pending, conn)
+}
+
+// start begins waiting for a join to be confirmed, unless it's already being waited for.
+func (j *joinTracker) start(config *Config, conn *irc.Connection, channel string) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.pending[conn] == nil {
+		j.pending[conn] = make(map[string]*pendingJoin)
+	}
+	key := strings.ToLower(channel)
+	if _, ok := j.pending[conn][key]; ok {
+		return
+	}
+
+	timeout := time.Duration(config.JoinTimeout)
+	if timeout <= 0 {
+		timeout = defaultJoinTimeout
+	}
+	join := &pendingJoin{}
+	join.timer = j.clock.AfterFunc(timeout, func() {
+		j.retry(config, conn, channel, join, timeout)
+	})
+	j.pending[conn][key] = join
+}
+
+// retry joins a channel again after its join timed out, up to the configured number of retries.
+func (j *joinTracker) retry(config *Config, conn *irc.Connection, channel string, join *pendingJoin, timeout time.Duration) {
+	j.Lock()
+	defer j.Unlock()
+
+	key := strings.ToLower(channel)
+	if j.pending[conn][key] != join {
+		return
+	}
+	if join.attempts >= config.JoinRetries || bans.has(conn, channel) {
+		slog.Warn("Join was not confirmed, giving up", "channel", channel, "attempts", join.attempts+1)
+		delete(j.pending[conn], key)
+		return
+	}
+
+	join.attempts++
+	slog.Info("Join was not confirmed, retrying", "channel", channel, "retry", join.attempts)
+	conn.Join(channel)
+	join.timer.Reset(timeout)
+}
+
+// done stops waiting for a join the server has confirmed.
+func (j *joinTracker) done(conn *irc.Connection, channel string) {
+	j.Lock()
+	defer j.Unlock()
+	if join, ok := j.pending[conn][strings.ToLower(channel)]; ok {
+		join.timer.Stop()
+		delete(j.pending[conn], strings.ToLower(channel))
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// newNetworkConn returns a connection registered as the libera network.
+func newNetworkConn(t *testing.T) *irc.Connection {
+	t.Helper()
+	conn := newMembersConn(t, nil)
+	connections.add("libera", conn, slog.Default())
+	t.Cleanup(func() { connections.remove(conn) })
+	return conn
+}
+
+func TestIsConfiguredChannel(t *testing.T) {
+	conn := newNetworkConn(t)
+	config := &Config{Networks: map[string]Network{"libera": {Channels: []string{"#Go", "secret"}}}}
+
+	tests := []struct {
+		channel string
+		want    bool
+	}{
+		{channel: "#go", want: true},
+		{channel: "#secret", want: true},
+		{channel: "#other", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			if got := isConfiguredChannel(config, conn, tt.channel); got != tt.want {
+				t.Errorf("isConfiguredChannel(%q) = %v, want %v", tt.channel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleInviteOnly(t *testing.T) {
+	previous := inviteRequests
+	inviteRequests = newWindowLimiter(inviteRequestWindow)
+	t.Cleanup(func() { inviteRequests = previous })
+
+	conn := newNetworkConn(t)
+	// Without a ChanServ nick the invite is counted but not requested
+	config := &Config{Networks: map[string]Network{"libera": {Channels: []string{"#secret"}}}}
+	requests := func(channel string) int {
+		inviteRequests.Lock()
+		defer inviteRequests.Unlock()
+		return len(inviteRequests.events["libera "+channel])
+	}
+	inviteOnly := func(channel string) {
+		handleInviteOnly(config, conn, &irc.Event{Code: "473", Arguments: []string{"gobot", channel, "Cannot join channel (+i)"}})
+	}
+
+	inviteOnly("#other")
+	if n := requests("#other"); n != 0 {
+		t.Errorf("invite requested %d times for a channel that isn't configured", n)
+	}
+
+	for range maxInviteRequests + 2 {
+		inviteOnly("#Secret")
+	}
+	if n := requests("#secret"); n != maxInviteRequests {
+		t.Errorf("invite requested %d times, want %d", n, maxInviteRequests)
+	}
+
+	handleInviteOnly(config, conn, &irc.Event{Code: "473", Arguments: []string{"gobot"}})
+}
+
+// pendingJoinFor returns the join being waited for on a channel, nil if there is none.
+func pendingJoinFor(conn *irc.Connection, channel string) *pendingJoin {
+	joins.Lock()
+	defer joins.Unlock()
+	return joins.pending[conn][channel]
+}
+
+func TestHandleBanned(t *testing.T) {
+	conn := newNetworkConn(t)
+	t.Cleanup(func() { bans.reset(conn) })
+	banned := func(args ...string) {
+		handleBanned(conn, &irc.Event{Code: "474", Arguments: args})
+	}
+
+	banned("gobot")
+	banned("gobot", "#Go", "Cannot join channel (+b)")
+	if !bans.has(conn, "#go") {
+		t.Fatal("ban was not recorded")
+	}
+	if bans.has(conn, "#other") {
+		t.Error("ban recorded for another channel")
+	}
+	if bans.has(irc.IRC("gobot", "gobot"), "#go") {
+		t.Error("ban recorded for another connection")
+	}
+
+	// Being let in lifts it
+	publish(EventJoin, &Config{}, conn, &irc.Event{Code: "JOIN", Nick: "gobot", Arguments: []string{"#go"}})
+	if bans.has(conn, "#go") {
+		t.Error("ban still recorded after joining")
+	}
+
+	banned("gobot", "#go", "Cannot join channel (+b)")
+	bans.reset(conn)
+	if bans.has(conn, "#go") {
+		t.Error("ban still recorded after a reset")
+	}
+}
+
+func TestBannedJoinIsNotRetried(t *testing.T) {
+	conn := newNetworkConn(t)
+	t.Cleanup(func() {
+		bans.reset(conn)
+		joins.reset(conn)
+	})
+	config := &Config{JoinRetries: 3, JoinTimeout: Duration(time.Hour)}
+
+	joins.start(config, conn, "#go")
+	handleBanned(conn, &irc.Event{Code: "474", Arguments: []string{"gobot", "#go", "Cannot join channel (+b)"}})
+
+	join := pendingJoinFor(conn, "#go")
+	if join == nil {
+		t.Fatal("join is not pending")
+	}
+	joins.retry(config, conn, "#go", join, time.Hour)
+	if pendingJoinFor(conn, "#go") != nil {
+		t.Error("join of a banned channel is still pending")
+	}
+	if join.attempts != 0 {
+		t.Errorf("attempts = %d, want 0", join.attempts)
+	}
+}
+
+func TestJoinTracker(t *testing.T) {
+	conn := newNetworkConn(t)
+	t.Cleanup(func() { joins.reset(conn) })
+	config := &Config{JoinRetries: 2, JoinTimeout: Duration(time.Hour)}
+
+	joins.start(config, conn, "#Go")
+	first := pendingJoinFor(conn, "#go")
+	if first == nil {
+		t.Fatal("join is not pending")
+	}
+	// A join that is already waited for isn't scheduled again
+	joins.start(config, conn, "#go")
+	if pendingJoinFor(conn, "#go") != first {
+		t.Error("join was scheduled twice")
+	}
+
+	// The server confirms the join with the end of the names list
+	joins.done(conn, "#GO")
+	if pendingJoinFor(conn, "#go") != nil {
+		t.Error("confirmed join is still pending")
+	}
+	// A timer of a join that was already confirmed does nothing
+	joins.retry(config, conn, "#go", first, time.Hour)
+	if pendingJoinFor(conn, "#go") != nil {
+		t.Error("retry of a confirmed join scheduled it again")
+	}
+
+	// Out of retries, so the last timeout gives up instead of joining again
+	joins.start(config, conn, "#go")
+	join := pendingJoinFor(conn, "#go")
+	join.attempts = config.JoinRetries
+	joins.retry(config, conn, "#go", join, time.Hour)
+	if pendingJoinFor(conn, "#go") != nil {
+		t.Error("join is still pending after the last retry")
+	}
+
+	joins.start(config, conn, "#go")
+	joins.start(config, conn, "#rust")
+	joins.reset(conn)
+	if pendingJoinFor(conn, "#go") != nil || pendingJoinFor(conn, "#rust") != nil {
+		t.Error("joins are still pending after a reset")
+	}
+}
+
+func TestJoinTrackerTimeout(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	previous := joins.clock
+	joins.clock = clock
+	conn, lines := newServerConn(t)
+	t.Cleanup(func() {
+		joins.reset(conn)
+		joins.clock = previous
+	})
+	config := &Config{JoinRetries: 1, JoinTimeout: Duration(time.Minute)}
+
+	joins.start(config, conn, "#go")
+	clock.advance(time.Minute - time.Second)
+	if got := sentLines(t, conn, lines); len(got) != 0 {
+		t.Errorf("sent %q before the join timed out", got)
+	}
+
+	clock.advance(time.Second)
+	if got, want := sentLines(t, conn, lines), []string{"JOIN #go"}; !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	// Out of retries, the next timeout gives up
+	clock.advance(time.Minute)
+	if got := sentLines(t, conn, lines); len(got) != 0 {
+		t.Errorf("sent %q after the last retry", got)
+	}
+	if pendingJoinFor(conn, "#go") != nil {
+		t.Error("join is still pending after the last retry")
+	}
+}
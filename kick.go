@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	// rejoinDelay is how long to wait before rejoining a channel the bot was kicked from
+	rejoinDelay = 5 * time.Second
+	kicksFile   = "kicks.json"
+)
+
+// kickCounter tracks how many times the bot has been kicked per channel and by whom on each network.
+type kickCounter struct {
+	sync.Mutex
+	loaded bool
+	// network -> channel -> kicker nick -> count
+	counts map[string]map[string]map[string]int
+}
+
+var kicks = &kickCounter{}
+
+// rejoinGreetings holds the channels the bot is rejoining after a kick, the rejoin message
+// is sent once the server confirms the join.
+type rejoinGreetings struct {
+	sync.Mutex
+	// connection -> lowercase channel
+	channels map[*irc.Connection]map[string]bool
+}
+
+var rejoins = &rejoinGreetings{channels: make(map[*irc.Connection]map[string]bool)}
+
+func init() {
+	registerFeature("kick", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("KICK", func(e *irc.Event) {
+			handleKick(config, conn, e)
+		})
+	})
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		rejoins.reset(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		rejoins.reset(conn)
+	})
+	subscribe(EventJoin, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		channel := e.Message()
+		if rejoins.take(conn, channel) && config.RejoinMessage != "" {
+			sendMessage(conn, channel, config.RejoinMessage)
+		}
+	})
+	registerCommand("kicks", kicksCommand)
+}
+
+func (r *rejoinGreetings) add(conn *irc.Connection, channel string) {
+	r.Lock()
+	defer r.Unlock()
+	if r.channels[conn] == nil {
+		r.channels[conn] = make(map[string]bool)
+	}
+	r.channels[conn][strings.ToLower(channel)] = true
+}
+
+// take reports whether the bot was rejoining the channel after a kick, and stops waiting for the join if so.
+func (r *rejoinGreetings) take(conn *irc.Connection, channel string) bool {
+	r.Lock()
+	defer r.Unlock()
+	key := strings.ToLower(channel)
+	if !r.channels[conn][key] {
+		return false
+	}
+	delete(r.channels[conn], key)
+	return true
+}
+
+func (r *rejoinGreetings) reset(conn *irc.Connection) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.channels, conn)
+}
+
+// load reads the persisted counts on first use. The caller must hold the lock.
+func (k *kickCounter) load(config *Config) error {
+	if k.loaded {
+		return nil
+	}
+	k.counts = make(map[string]map[string]map[string]int)
+	if err := loadJSON(config, kicksFile, &k.counts); err != nil {
+		return err
+	}
+	k.loaded = true
+	return nil
+}
+
+// record increments the kick count for channel and kicker on the network and persists the result.
+func (k *kickCounter) record(config *Config, network, channel, kicker string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	if err := k.load(config); err != nil {
+		return err
+	}
+	channel = strings.ToLower(channel)
+	if k.counts[network] == nil {
+		k.counts[network] = make(map[string]map[string]int)
+	}
+	if k.counts[network][channel] == nil {
+		k.counts[network][channel] = make(map[string]int)
+	}
+	k.counts[network][channel][kicker]++
+	return saveJSON(config, kicksFile, k.counts)
+}
+
+// snapshot returns a copy of the counts of a network.
+func (k *kickCounter) snapshot(config *Config, network string) (map[string]map[string]int, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	if err := k.load(config); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]map[string]int, len(k.counts[network]))
+	for channel, kickers := range k.counts[network] {
+		counts[channel] = make(map[string]int, len(kickers))
+		for kicker, count := range kickers {
+			counts[channel][kicker] = count
+		}
+	}
+	return counts, nil
+}
+
+// sumKicks returns the total count of kicks.
+func sumKicks(kickers map[string]int) int {
+	total := 0
+	for _, count := range kickers {
+		total += count
+	}
+	return total
+}
+
+// kicksCommand handles ".kicks" for a per-channel summary and ".kicks <channel>" for the kickers of one channel.
+func kicksCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	counts, err := kicks.snapshot(config, connections.name(conn))
+	if err != nil {
+		return "", err
+	}
+
+	if len(args) > 0 {
+		channel := strings.ToLower(args[0])
+		kickers := counts[channel]
+		if len(kickers) == 0 {
+			return fmt.Sprintf("Never been kicked from %s", args[0]), nil
+		}
+		var names []string
+		for kicker := range kickers {
+			names = append(names, kicker)
+		}
+		// Most active kickers first
+		sort.Slice(names, func(i, j int) bool {
+			if kickers[names[i]] != kickers[names[j]] {
+				return kickers[names[i]] > kickers[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		var parts []string
+		for _, name := range names {
+			parts = append(parts, fmt.Sprintf("%s: %d", name, kickers[name]))
+		}
+		return fmt.Sprintf("Kicked from %s %d times (%s)", args[0], sumKicks(kickers), strings.Join(parts, ", ")), nil
+	}
+
+	if len(counts) == 0 {
+		return "Never been kicked", nil
+	}
+	var channels []string
+	for channel := range counts {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	var parts []string
+	for _, channel := range channels {
+		parts = append(parts, fmt.Sprintf("%s: %d", channel, sumKicks(counts[channel])))
+	}
+	return "Kicks: " + strings.Join(parts, ", "), nil
+}
+
+// kickReason returns the reason given in a KICK event, or an empty string if there was none.
+func kickReason(e *irc.Event) string {
+	if len(e.Arguments) < 3 {
+		return ""
+	}
+	return e.Arguments[2]
+}
+
+// handleKick logs kicks targeting the bot and rejoins the channel, greeting it with the rejoin message once it's back.
+func handleKick(config *Config, conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) < 2 || !strings.EqualFold(e.Arguments[1], botNick(conn)) {
+		return
+	}
+	channel := e.Arguments[0]
+
+	slog.Warn("Kicked from channel", "channel", channel, "by", e.Nick, "reason", kickReason(e))
+	if err := kicks.record(config, connections.name(conn), channel, e.Nick); err != nil {
+		slog.Error("Error recording kick", "error", err)
+	}
+
+	defaultClock.AfterFunc(rejoinDelay, func() {
+		if bans.has(conn, channel) {
+			return
+		}
+		if config.RejoinMessage != "" {
+			rejoins.add(conn, channel)
+		}
+		joinChannel(config, conn, channel)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestKicksCommand(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	kicks = &kickCounter{}
+	t.Cleanup(func() { kicks = &kickCounter{} })
+
+	for _, kick := range []struct{ network, channel, kicker string }{
+		{"libera", "#Go", "alice"},
+		{"libera", "#go", "bob"},
+		{"libera", "#go", "bob"},
+		{"libera", "#rust", "carol"},
+		{"oftc", "#go", "dave"},
+	} {
+		if err := kicks.record(config, kick.network, kick.channel, kick.kicker); err != nil {
+			t.Fatalf("record() error = %v", err)
+		}
+	}
+
+	conn := irc.IRC("gobot", "gobot")
+	connections.add("libera", conn, slog.Default())
+	t.Cleanup(func() { connections.remove(conn) })
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "summary", want: "Kicks: #go: 3, #rust: 1"},
+		{name: "channel", args: []string{"#GO"}, want: "Kicked from #GO 3 times (bob: 2, alice: 1)"},
+		{name: "never kicked", args: []string{"#python"}, want: "Never been kicked from #python"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &irc.Event{Nick: "alice", Arguments: []string{"#go", ".kicks"}}
+			got, err := kicksCommand(config, conn, e, tt.args)
+			if err != nil || got != tt.want {
+				t.Errorf("kicksCommand() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// The counts are read back per network
+	counts, err := (&kickCounter{}).snapshot(config, "oftc")
+	if err != nil || len(counts) != 1 || counts["#go"]["dave"] != 1 {
+		t.Errorf("snapshot(oftc) = %v, %v, want #go: dave: 1", counts, err)
+	}
+}
+
+func TestKickReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments []string
+		want      string
+	}{
+		{name: "reason", arguments: []string{"#go", "gobot", "flooding"}, want: "flooding"},
+		{name: "reason with spaces", arguments: []string{"#go", "gobot", "take a break"}, want: "take a break"},
+		{name: "no reason", arguments: []string{"#go", "gobot"}, want: ""},
+		{name: "empty reason", arguments: []string{"#go", "gobot", ""}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kickReason(&irc.Event{Code: "KICK", Arguments: tt.arguments}); got != tt.want {
+				t.Errorf("kickReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejoinMessageAfterJoin(t *testing.T) {
+	useInstantClock(t)
+	kicks = &kickCounter{}
+	t.Cleanup(func() { kicks = &kickCounter{} })
+
+	conn, lines := newServerConn(t)
+	t.Cleanup(func() { rejoins.reset(conn) })
+	config := &Config{DataDir: t.TempDir(), RejoinMessage: "I'm back"}
+	for _, f := range features {
+		if f.name == "kick" || f.name == "events" {
+			f.setup(config, conn)
+		}
+	}
+	join := &irc.Event{Code: "JOIN", Nick: "gobot", Source: "gobot!gobot@example.com", Arguments: []string{"#GO"}}
+
+	conn.RunCallbacks(&irc.Event{Code: "KICK", Nick: "alice", Source: "alice!alice@example.com", Arguments: []string{"#go", "gobot", "out"}})
+	if got := nextLine(t, lines); got != "JOIN #go" {
+		t.Fatalf("sent %q after the kick, want JOIN #go", got)
+	}
+	if got := sentLines(t, conn, lines); len(got) != 0 {
+		t.Errorf("sent %q before the join was confirmed", got)
+	}
+
+	conn.RunCallbacks(join)
+	if got, want := sentLines(t, conn, lines), []string{"PRIVMSG #GO :I'm back"}; !slices.Equal(got, want) {
+		t.Errorf("sent %q after joining, want %q", got, want)
+	}
+
+	// Later joins aren't rejoins after a kick
+	conn.RunCallbacks(join)
+	if got := sentLines(t, conn, lines); len(got) != 0 {
+		t.Errorf("sent %q on another join", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// windowLimiter allows at most limit events per key within a sliding window.
+type windowLimiter struct {
+	sync.Mutex
+	clock  Clock
+	window time.Duration
+	events map[string][]time.Time
+	// keys that have already been told they are over the limit in the current window
+	warned map[string]bool
+}
+
+func newWindowLimiter(window time.Duration) *windowLimiter {
+	return &windowLimiter{
+		clock:  defaultClock,
+		window: window,
+		events: make(map[string][]time.Time),
+		warned: make(map[string]bool),
+	}
+}
+
+// allow records an event for key and reports whether it is within the limit.
+// The second return value is true only for the first rejected event in a window,
+// so callers can warn once instead of on every rejection.
+func (l *windowLimiter) allow(key string, limit int) (bool, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.clock.Now()
+	// Keys whose events have all left the window are as good as new, drop them so the map doesn't grow
+	for k, events := range l.events {
+		if k != key && (len(events) == 0 || now.Sub(events[len(events)-1]) >= l.window) {
+			delete(l.events, k)
+			delete(l.warned, k)
+		}
+	}
+
+	recent := l.events[key][:0]
+	for _, t := range l.events[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) >= limit {
+		l.events[key] = recent
+		first := !l.warned[key]
+		l.warned[key] = true
+		return false, first
+	}
+
+	l.events[key] = append(recent, now)
+	delete(l.warned, key)
+	return true, false
+}
+
+// forget drops the events of every key starting with prefix.
+func (l *windowLimiter) forget(prefix string) {
+	l.Lock()
+	defer l.Unlock()
+	for k := range l.events {
+		if strings.HasPrefix(k, prefix) {
+			delete(l.events, k)
+			delete(l.warned, k)
+		}
+	}
+}
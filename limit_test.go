@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowLimiter(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	limiter := newWindowLimiter(time.Minute)
+	limiter.clock = clock
+
+	type step struct {
+		key       string
+		advance   time.Duration
+		wantAllow bool
+		wantWarn  bool
+	}
+	steps := []step{
+		{key: "libera alice", wantAllow: true},
+		{key: "libera alice", advance: 10 * time.Second, wantAllow: true},
+		{key: "libera alice", advance: 10 * time.Second, wantAllow: false, wantWarn: true},
+		// Only the first rejection in a window warns
+		{key: "libera alice", wantAllow: false, wantWarn: false},
+		// The same nick on another network has a limit of its own
+		{key: "oftc alice", wantAllow: true},
+		// The first event has left the window
+		{key: "libera alice", advance: 41 * time.Second, wantAllow: true},
+		{key: "libera alice", wantAllow: false, wantWarn: true},
+	}
+
+	for i, s := range steps {
+		clock.now = clock.now.Add(s.advance)
+		allowed, warn := limiter.allow(s.key, 2)
+		if allowed != s.wantAllow || warn != s.wantWarn {
+			t.Errorf("step %d: allow(%q) = %v, %v, want %v, %v", i, s.key, allowed, warn, s.wantAllow, s.wantWarn)
+		}
+	}
+}
+
+func TestWindowLimiterDropsQuietKeys(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	limiter := newWindowLimiter(time.Minute)
+	limiter.clock = clock
+
+	for _, key := range []string{"libera alice", "libera bob", "oftc alice"} {
+		limiter.allow(key, 1)
+	}
+	limiter.allow("libera alice", 1)
+	clock.advance(time.Minute)
+	limiter.allow("libera carol", 1)
+	if len(limiter.events) != 1 || len(limiter.warned) != 0 {
+		t.Errorf("limiter has events for %d keys and warnings for %d, want only the new key", len(limiter.events), len(limiter.warned))
+	}
+
+	limiter.allow("oftc alice", 1)
+	limiter.forget("libera ")
+	if _, ok := limiter.events["libera carol"]; ok {
+		t.Error("forget() kept a key with the prefix")
+	}
+	if allowed, _ := limiter.allow("oftc alice", 1); allowed {
+		t.Error("forget() dropped a key of another network")
+	}
+}
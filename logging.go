@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newLogHandler returns the handler for the configured log level and format writing to w.
+// Unknown values fall back to info and text, they are returned as warnings to log once logging is set up.
+func newLogHandler(logging LoggingConfig, w io.Writer) (slog.Handler, []string) {
+	var warnings []string
+
+	level := slog.LevelInfo
+	if logging.Level != "" {
+		if err := level.UnmarshalText([]byte(logging.Level)); err != nil {
+			warnings = append(warnings, fmt.Sprintf("unknown log level %q, using info", logging.Level))
+			level = slog.LevelInfo
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(logging.Format) {
+	case "", "text":
+		return slog.NewTextHandler(w, options), warnings
+	case "json":
+		return slog.NewJSONHandler(w, options), warnings
+	default:
+		warnings = append(warnings, fmt.Sprintf("unknown log format %q, using text", logging.Format))
+		return slog.NewTextHandler(w, options), warnings
+	}
+}
+
+// maxIRCLogMessages is how many log messages are sent to a log channel per minute
+const maxIRCLogMessages = 5
+
+// ircLogHandler passes records to the next handler and also sends error level records to the log channels of the networks.
+type ircLogHandler struct {
+	next    slog.Handler
+	config  *Config
+	limiter *windowLimiter
+	sends   *pendingSends
+	attrs   []slog.Attr
+	group   string
+}
+
+func newIRCLogHandler(config *Config, next slog.Handler) *ircLogHandler {
+	return &ircLogHandler{
+		next:    next,
+		config:  config,
+		limiter: newWindowLimiter(time.Minute),
+		sends:   &pendingSends{counts: make(map[string]int)},
+	}
+}
+
+// pendingSends counts the log lines still being sent to each network, so that a connection
+// that isn't writing doesn't collect a goroutine for every record.
+type pendingSends struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+// start reports whether another send to the network can begin, and counts it if so.
+func (p *pendingSends) start(network string, limit int) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.counts[network] >= limit {
+		return false
+	}
+	p.counts[network]++
+	return true
+}
+
+// done marks a send to the network as finished.
+func (p *pendingSends) done(network string) {
+	p.Lock()
+	defer p.Unlock()
+	p.counts[network]--
+	if p.counts[network] <= 0 {
+		delete(p.counts, network)
+	}
+}
+
+func (h *ircLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelError || h.next.Enabled(ctx, level)
+}
+
+func (h *ircLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		h.sendToIRC(r)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *ircLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	clone.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr.Key = h.group + "." + attr.Key
+		}
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *ircLogHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	clone.group = name
+	return &clone
+}
+
+// formatIRCLog formats a record as a single IRC line, "ERROR message key=value ...".
+func formatIRCLog(r slog.Record, attrs []slog.Attr) string {
+	var b strings.Builder
+	b.WriteString(r.Level.String())
+	b.WriteString(" ")
+	b.WriteString(r.Message)
+
+	write := func(attr slog.Attr) {
+		fmt.Fprintf(&b, " %s=%v", attr.Key, attr.Value.Resolve())
+	}
+	for _, attr := range attrs {
+		write(attr)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		write(attr)
+		return true
+	})
+	return stripControl(b.String())
+}
+
+// recordNetwork returns the network a record came from, preferring one given when logging over the
+// one of the logger, or an empty string if the record isn't tied to a network.
+// The attributes of a record logged in a group belong to the group, not to the record.
+func recordNetwork(r slog.Record, attrs []slog.Attr, group string) string {
+	network := ""
+	for _, attr := range attrs {
+		if attr.Key == "network" {
+			network = attr.Value.String()
+		}
+	}
+	if group != "" {
+		return network
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == "network" {
+			network = attr.Value.String()
+		}
+		return true
+	})
+	return network
+}
+
+// sendToIRC sends the record to the log channel of the network it came from, or every log channel
+// if it isn't tied to a network. Messages over the rate limit are dropped.
+func (h *ircLogHandler) sendToIRC(r slog.Record) {
+	network := recordNetwork(r, h.attrs, h.group)
+	line := formatIRCLog(r, h.attrs)
+
+	for name, n := range h.config.Networks {
+		if n.LogChannel == "" || (network != "" && name != network) {
+			continue
+		}
+		conn, ok := connections.get(name)
+		if !ok {
+			continue
+		}
+		if allowed, _ := h.limiter.allow(name, maxIRCLogMessages); !allowed {
+			continue
+		}
+		// Don't block logging on a connection that isn't writing, one line per record is enough
+		if !h.sends.start(name, maxIRCLogMessages) {
+			continue
+		}
+		channel := normalizeChannel(conn, n.LogChannel)
+		go func(name string) {
+			defer h.sends.done(name)
+			sendMessage(conn, channel, truncateMessage(conn, channel, line))
+		}(name)
+	}
+}
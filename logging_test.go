@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecordNetwork(t *testing.T) {
+	base := newIRCLogHandler(&Config{}, slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name    string
+		handler slog.Handler
+		attrs   []slog.Attr
+		want    string
+	}{
+		{name: "none", handler: base, want: ""},
+		{name: "logger", handler: base.WithAttrs([]slog.Attr{slog.String("network", "libera")}), want: "libera"},
+		{name: "call site", handler: base, attrs: []slog.Attr{slog.String("network", "oftc")}, want: "oftc"},
+		{
+			name:    "call site wins",
+			handler: base.WithAttrs([]slog.Attr{slog.String("network", "libera")}),
+			attrs:   []slog.Attr{slog.String("network", "oftc")},
+			want:    "oftc",
+		},
+		{
+			name:    "grouped record attributes",
+			handler: base.WithAttrs([]slog.Attr{slog.String("network", "libera")}).WithGroup("request"),
+			attrs:   []slog.Attr{slog.String("network", "oftc")},
+			want:    "libera",
+		},
+		{name: "grouped logger attributes", handler: base.WithGroup("request").WithAttrs([]slog.Attr{slog.String("network", "oftc")}), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.handler.(*ircLogHandler)
+			r := slog.NewRecord(time.Now(), slog.LevelError, "failed", 0)
+			r.AddAttrs(tt.attrs...)
+			if got := recordNetwork(r, h.attrs, h.group); got != tt.want {
+				t.Errorf("recordNetwork() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatIRCLog(t *testing.T) {
+	r := slog.NewRecord(time.Now(), slog.LevelError, "Error handling command", 0)
+	r.AddAttrs(slog.String("command", "weather"), slog.Int("status", 502))
+
+	got := formatIRCLog(r, []slog.Attr{slog.String("network", "libera")})
+	want := "ERROR Error handling command network=libera command=weather status=502"
+	if got != want {
+		t.Errorf("formatIRCLog() = %q, want %q", got, want)
+	}
+}
+
+func TestPendingSends(t *testing.T) {
+	sends := &pendingSends{counts: make(map[string]int)}
+
+	for i := range 2 {
+		if !sends.start("libera", 2) {
+			t.Fatalf("start() %d = false, want true", i)
+		}
+	}
+	if sends.start("libera", 2) {
+		t.Error("start() over the limit = true, want false")
+	}
+	if !sends.start("oftc", 2) {
+		t.Error("start() on another network = false, want true")
+	}
+
+	sends.done("libera")
+	if !sends.start("libera", 2) {
+		t.Error("start() after done() = false, want true")
+	}
+}
+
+func TestIRCLogRateLimit(t *testing.T) {
+	conn, lines := newServerConn(t)
+	config := &Config{Networks: map[string]Network{"libera": {LogChannel: "#log"}}}
+	clock := &manualClock{now: time.Now()}
+	h := newIRCLogHandler(config, slog.NewTextHandler(io.Discard, nil))
+	h.limiter.clock = clock
+
+	logError := func(message string) {
+		t.Helper()
+		if err := h.Handle(context.Background(), slog.NewRecord(clock.Now(), slog.LevelError, message, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want []string
+	for i := range maxIRCLogMessages + 3 {
+		logError(fmt.Sprintf("failed %d", i))
+		if i < maxIRCLogMessages {
+			want = append(want, fmt.Sprintf("PRIVMSG #log :ERROR failed %d", i))
+		}
+	}
+	// The lines are sent in their own goroutines, in any order
+	var got []string
+	for range maxIRCLogMessages {
+		got = append(got, nextLine(t, lines))
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+	if extra := sentLines(t, conn, lines); len(extra) != 0 {
+		t.Errorf("sent %q over the limit", extra)
+	}
+
+	clock.advance(time.Minute)
+	logError("failed again")
+	if got, want := nextLine(t, lines), "PRIVMSG #log :ERROR failed again"; got != want {
+		t.Errorf("sent %q after the window, want %q", got, want)
+	}
+}
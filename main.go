@@ -1,188 +1,243 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/url"
+	"log/slog"
 	"os"
-	"strings"
+	"os/signal"
+	"runtime"
 	"sync"
+	"syscall"
+	"time"
 
 	irc "github.com/thoj/go-ircevent"
 	"gopkg.in/yaml.v2"
 )
 
-type Network struct {
-	Channels []string `yaml:"channels"`
-	Server   string   `yaml:"server"`
-	UseTLS   bool     `yaml:"usetls"`
-	Port     int      `yaml:"port"`
-}
+var Version = "development"
 
-type APIConfig struct {
-	Endpoint string `yaml:"endpoint"`
-	APIKey   string `yaml:"apiKey"`
-}
+// BuildDate is set at build time like Version, it's left out of the version output when empty
+var BuildDate = ""
 
-type Config struct {
-	Networks      map[string]Network `yaml:"networks"`
-	Nickname      string             `yaml:"nickname"`
-	LambdaTitle   APIConfig          `yaml:"lambdatitle"`
-	LambdaCommand APIConfig          `yaml:"lambdacommand"`
-	Addit         APIConfig          `yaml:"addconfig"`
+// versionString returns the version, build date and Go version for -version.
+func versionString() string {
+	s := "gobotlite " + Version
+	if BuildDate != "" {
+		s += " built " + BuildDate
+	}
+	return s + " with " + runtime.Version()
 }
 
-var Version = "development"
+// shutdownTimeout is how long to wait for connections to close after QUIT when shutting down
+const shutdownTimeout = 5 * time.Second
 
-func (c *Config) Validate() error {
-	if c.Nickname == "" {
-		return fmt.Errorf("nickname is missing from configuration")
-	}
-	if c.LambdaCommand.Endpoint == "" {
-		return fmt.Errorf("command endpoint is missing from configuration")
-	}
-	if c.LambdaTitle.Endpoint == "" {
-		return fmt.Errorf("title endpoint is missing from configuration")
+// defaultConfigPath is read when neither -config nor GOBOTLITE_CONFIG is given
+const defaultConfigPath = "config.yaml"
+
+// configPath returns the configuration file to read, the -config flag takes precedence over GOBOTLITE_CONFIG.
+func configPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
 	}
-	for networkName, network := range c.Networks {
-		if network.Server == "" {
-			return fmt.Errorf("server is missing from configuration for network: %s", networkName)
-		}
-		if len(network.Channels) == 0 {
-			return fmt.Errorf("no channels specified in configuration for network: %s", networkName)
-		}
-		// More specific validations can be added here, such as checking the port range, TLS config, etc.
+	if path := os.Getenv("GOBOTLITE_CONFIG"); path != "" {
+		return path
 	}
-	return nil
+	return defaultConfigPath
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
 func main() {
+	configFlag := flag.String("config", "", "path to the configuration file, defaults to $GOBOTLITE_CONFIG or "+defaultConfigPath)
+	envFlag := flag.String("env", "", "environment whose configuration overlay, e.g. config.<env>.yaml, is merged on top, defaults to $GOBOTLITE_ENV")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
 	config := Config{}
 
-	log.Printf("Starting bot version %s", Version)
+	slog.Info("Starting bot", "version", Version)
 
 	// Read the YAML configuration file
-	data, err := os.ReadFile("config.yaml")
+	path := configPath(*configFlag)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fatal("Configuration file not found", "path", path)
+	}
 	if err != nil {
-		log.Fatalf("Error reading YAML file: %s\n", err)
+		fatal("Error reading YAML file", "path", path, "error", err)
+	}
+
+	// Settings of the environment overlay replace those of the base file
+	if overlay := overlayPath(path, *envFlag); overlay != "" {
+		overlayData, err := os.ReadFile(overlay)
+		if errors.Is(err, os.ErrNotExist) {
+			fatal("Configuration overlay not found", "path", overlay)
+		}
+		if err != nil {
+			fatal("Error reading YAML file", "path", overlay, "error", err)
+		}
+		data, err = applyOverlay(data, overlayData)
+		if err != nil {
+			fatal("Error merging configuration overlay", "path", overlay, "error", err)
+		}
+		slog.Info("Merged configuration overlay", "path", overlay)
 	}
 
 	// Unmarshal the YAML data into the Config struct
 	err = yaml.Unmarshal([]byte(data), &config)
 	if err != nil {
-		log.Fatalf("Error parsing YAML file: %s\n", err)
+		fatal("Error parsing YAML file", "error", err)
+	}
+
+	err = config.ApplyLegacyKeys()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+
+	err = config.LoadSecrets()
+	if err != nil {
+		fatal("Error loading secrets", "error", err)
 	}
 
 	err = config.Validate()
 	if err != nil {
-		log.Fatalf("Invalid configuration: %s\n", err)
+		fatal("Invalid configuration", "error", err)
 	}
 
+	// Errors are also reported on IRC for networks that have a log channel
+	handler, warnings := newLogHandler(config.Logging, os.Stderr)
+	slog.SetDefault(slog.New(newIRCLogHandler(&config, handler)))
+	for _, warning := range warnings {
+		slog.Warn("Invalid logging configuration", "problem", warning)
+	}
+
+	// Both backends are optional, the matching feature is just turned off
+	if config.CommandBackend.Endpoint == "" {
+		slog.Info("No command endpoint configured, only local commands are available")
+	}
+	if config.TitleBackend.Endpoint == "" {
+		slog.Info("No title endpoint configured, URL titles are disabled")
+	}
+
+	if len(config.Admins) == 0 {
+		slog.Info("No admins configured, admin commands are disabled")
+	}
+
+	if config.Security.AllowInsecureTLS {
+		slog.Warn("TLS certificate verification is disabled, connections can be intercepted")
+	}
+
+	// Cancelled on SIGINT or SIGTERM, connections quit and stop reconnecting when it is
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	var wg sync.WaitGroup
 
-	for _, network := range config.Networks {
+	for name, network := range config.Networks {
 		wg.Add(1)
 
-		go func(network Network) {
+		go func(name string, network Network) {
 			defer wg.Done()
-
-			// Create new IRC connection with nickname from config
-			conn := irc.IRC(config.Nickname, config.Nickname)
-			if conn == nil {
-				log.Fatalf("Error creating IRC connection")
-				return
-			}
-
-			conn.Debug = false
-			conn.UseTLS = network.UseTLS
-			conn.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-
-			// Add callback for IRC connection
-			conn.AddCallback("001", func(e *irc.Event) {
-				for _, channel := range network.Channels {
-					// Default to #channels
-					if !strings.HasPrefix(channel, "#") {
-						channel = "#" + channel
-					}
-					conn.Join(channel)
-				}
+			superviseNetwork(ctx, &config, name, func(ctx context.Context, connected func()) error {
+				return runNetwork(ctx, &config, name, network, connected)
 			})
+		}(name, network)
+	}
 
-			conn.AddCallback("366", func(e *irc.Event) {
-				log.Printf("Joined %s", e.Arguments[1])
-			})
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			slog.Warn("Connections did not close in time, exiting anyway")
+		}
+	}
+}
 
-			// Add callback for PRIVMSG
-			conn.AddCallback("PRIVMSG", func(e *irc.Event) {
-				var channel = e.Arguments[0]
-				// Ignore other bots
-				if e.Nick == "Sinkko" {
-					return
-				}
-
-				// log.Printf("PRIVMSG: %s", e.Message())
-
-				words := strings.Fields(e.Message())
-
-				// nothing to process
-				if len(words) == 0 {
-					return
-				}
-
-				// handle commands, command needs to be at least one character past prefix
-				if strings.HasPrefix(e.Message(), ".") && len(e.Message()) > 1 {
-					//nolint:errcheck
-					go handleCommand(&config, conn, e, e.Message()[1:])
-					return
-				}
-
-				// If it wasn't a command, check if it's an URL
-				for _, word := range words {
-					if !strings.HasPrefix(word, "http") {
-						continue
-					}
-
-					u, err := url.Parse(word)
-
-					if err != nil {
-						log.Printf("Error parsing potential URL '%s': %s", word, err)
-					} else if u.Scheme != "" && u.Host != "" {
-						// ignore if prefixed with *
-						// matrix bridges do this when linking to Discord and it's annoying AF
-						if strings.HasPrefix(e.Message(), "*") {
-							log.Printf("Ignoring URL: %s", u.String())
-
-						} else {
-							// Valid URL detected, handle accordingly
-							log.Printf("URL detected on %s: %s", channel, u.String())
-							go handleURL(&config, conn, e, u.String())
-						}
-					}
-				}
-			})
+// runNetwork connects to a network and handles it until the connection is closed, calling connected once it's up.
+// The state kept for the connection is dropped when it returns, a restart starts over with a new connection.
+func runNetwork(ctx context.Context, config *Config, name string, network Network, connected func()) error {
+	// Create new IRC connection with nickname from config
+	nick := config.nickname(network)
+	conn := irc.IRC(nick, nick)
+	if conn == nil {
+		return fmt.Errorf("error creating IRC connection")
+	}
+
+	// Records logged for this network carry its name, which also routes errors to its log channel
+	logger := slog.With("network", name, "server", network.Server)
+	connections.add(name, conn, logger)
+	defer func() {
+		publish(EventClosed, config, conn, nil)
+		connections.remove(conn)
+	}()
+
+	conn.Debug = false
+	conn.QuitMessage = config.QuitMessage
+	conn.UseTLS = network.UseTLS
+	conn.TLSConfig = &tls.Config{
+		ServerName:         network.Server,
+		InsecureSkipVerify: config.Security.AllowInsecureTLS,
+	}
 
-			// Add callback for PING messages
-			conn.AddCallback("PING", func(e *irc.Event) { conn.SendRaw("PONG :" + e.Message()) })
+	// Validate already checked the encoding
+	conn.Encoding, _ = network.encoding()
 
-			// Handle nonstandard ports
-			var port = 6667
-			if network.Port != 0 {
-				port = network.Port
-			}
+	conn.AddCallback("366", func(e *irc.Event) {
+		logger.Info("Joined channel", "channel", e.Arguments[1])
+	})
 
-			// Connect to the IRC server
-			server := fmt.Sprintf("%s:%d", network.Server, port)
-			err = conn.Connect(server)
-			if err != nil {
-				fmt.Printf("Err %s", err)
-				return
-			}
+	setupFeatures(config, conn)
 
-			// Start IRC connection
-			conn.Loop()
-		}(network)
+	// Add callback for PING messages
+	conn.AddCallback("PING", func(e *irc.Event) { conn.SendRaw("PONG :" + e.Message()) })
+
+	// Handle nonstandard ports
+	var port = 6667
+	if network.Port != 0 {
+		port = network.Port
+	}
+
+	// Connect to the IRC server
+	server := fmt.Sprintf("%s:%d", network.Server, port)
+	// After the first connection the IRC library reconnects by itself
+	err := connectWithRetry(ctx, conn, server, config.ConnectRetries)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", server, err)
 	}
+	connected()
+
+	// Quitting stops the reconnect loop of the IRC library as well
+	go func() {
+		<-ctx.Done()
+		if conn.Connected() {
+			logger.Info("Quitting")
+			conn.Quit()
+		}
+	}()
 
-	wg.Wait()
+	// Start IRC connection
+	conn.Loop()
+	return nil
 }
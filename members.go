@@ -0,0 +1,332 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// member is a single user on a channel.
+type member struct {
+	Nick     string
+	Prefixes string
+}
+
+// channelState is the cached state of a single joined channel.
+type channelState struct {
+	// lowercase nick -> member
+	members map[string]*member
+	// when the channel last became empty apart from the bot, zero if it isn't
+	emptySince time.Time
+}
+
+// membership caches the members of the channels each connection has joined.
+type membership struct {
+	sync.Mutex
+	clock Clock
+	// connection -> lowercase channel -> state
+	channels map[*irc.Connection]map[string]*channelState
+}
+
+var members = &membership{clock: defaultClock, channels: make(map[*irc.Connection]map[string]*channelState)}
+
+func init() {
+	// NAMES lists only the highest prefix of each member without multi-prefix
+	wantCap("multi-prefix")
+
+	// Start from scratch on every (re)connect
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		members.reset(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		members.reset(conn)
+		stopEmptyChannelCheck(conn)
+	})
+
+	registerFeature("members", func(config *Config, conn *irc.Connection) {
+		trackMembers(conn)
+		go partEmptyChannels(config, conn, emptyChannelStop(conn))
+	})
+}
+
+// trackMembers registers the callbacks that keep the membership cache up to date.
+func trackMembers(conn *irc.Connection) {
+	// 353: RPL_NAMREPLY "<me> <type> <channel> :<names>"
+	conn.AddCallback("353", func(e *irc.Event) {
+		if len(e.Arguments) < 4 {
+			return
+		}
+		_, symbols := prefixSymbols(conn)
+		for _, name := range strings.Fields(e.Arguments[3]) {
+			// With multi-prefix a member can have several prefixes, e.g. "@+nick"
+			nick := strings.TrimLeft(name, symbols)
+			members.join(conn, e.Arguments[2], nick, orderPrefixes(name[:len(name)-len(nick)], symbols))
+		}
+	})
+
+	conn.AddCallback("JOIN", func(e *irc.Event) {
+		if strings.EqualFold(e.Nick, botNick(conn)) {
+			members.clear(conn, e.Message())
+		}
+		members.join(conn, e.Message(), e.Nick, "")
+	})
+
+	conn.AddCallback("PART", func(e *irc.Event) {
+		if len(e.Arguments) == 0 {
+			return
+		}
+		members.part(conn, e.Arguments[0], e.Nick)
+	})
+
+	conn.AddCallback("KICK", func(e *irc.Event) {
+		if len(e.Arguments) < 2 {
+			return
+		}
+		members.part(conn, e.Arguments[0], e.Arguments[1])
+	})
+
+	conn.AddCallback("QUIT", func(e *irc.Event) {
+		members.quit(conn, e.Nick)
+	})
+
+	conn.AddCallback("NICK", func(e *irc.Event) {
+		members.rename(conn, e.Nick, e.Message())
+	})
+}
+
+// channel returns the state of a channel, creating it if needed. The caller must hold the lock.
+func (m *membership) channel(conn *irc.Connection, channel string) *channelState {
+	channels, ok := m.channels[conn]
+	if !ok {
+		channels = make(map[string]*channelState)
+		m.channels[conn] = channels
+	}
+	state, ok := channels[strings.ToLower(channel)]
+	if !ok {
+		state = &channelState{members: make(map[string]*member)}
+		channels[strings.ToLower(channel)] = state
+	}
+	return state
+}
+
+// updateEmpty records when a channel became empty apart from the bot. The caller must hold the lock.
+func (m *membership) updateEmpty(conn *irc.Connection, state *channelState) {
+	_, hasSelf := state.members[strings.ToLower(botNick(conn))]
+	empty := len(state.members) == 0 || (len(state.members) == 1 && hasSelf)
+
+	if !empty {
+		state.emptySince = time.Time{}
+	} else if state.emptySince.IsZero() {
+		state.emptySince = m.clock.Now()
+	}
+}
+
+// reset forgets everything known about a connection.
+func (m *membership) reset(conn *irc.Connection) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.channels, conn)
+}
+
+// clear forgets the members of a channel, used when the bot (re)joins it.
+func (m *membership) clear(conn *irc.Connection, channel string) {
+	m.Lock()
+	defer m.Unlock()
+	if channels, ok := m.channels[conn]; ok {
+		delete(channels, strings.ToLower(channel))
+	}
+}
+
+// join adds a member to a channel.
+func (m *membership) join(conn *irc.Connection, channel, nick, prefixes string) {
+	if nick == "" {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	state := m.channel(conn, channel)
+	state.members[strings.ToLower(nick)] = &member{Nick: nick, Prefixes: prefixes}
+	m.updateEmpty(conn, state)
+}
+
+// part removes a member from a channel, or the whole channel if the member is the bot.
+func (m *membership) part(conn *irc.Connection, channel, nick string) {
+	m.Lock()
+	defer m.Unlock()
+
+	channels, ok := m.channels[conn]
+	if !ok {
+		return
+	}
+	if strings.EqualFold(nick, botNick(conn)) {
+		delete(channels, strings.ToLower(channel))
+		return
+	}
+	if state, ok := channels[strings.ToLower(channel)]; ok {
+		delete(state.members, strings.ToLower(nick))
+		m.updateEmpty(conn, state)
+	}
+}
+
+// quit removes a member from every channel.
+func (m *membership) quit(conn *irc.Connection, nick string) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, state := range m.channels[conn] {
+		if _, ok := state.members[strings.ToLower(nick)]; ok {
+			delete(state.members, strings.ToLower(nick))
+			m.updateEmpty(conn, state)
+		}
+	}
+}
+
+// rename follows a nick change on every channel.
+func (m *membership) rename(conn *irc.Connection, oldNick, newNick string) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, state := range m.channels[conn] {
+		if mem, ok := state.members[strings.ToLower(oldNick)]; ok {
+			delete(state.members, strings.ToLower(oldNick))
+			mem.Nick = newNick
+			state.members[strings.ToLower(newNick)] = mem
+		}
+	}
+}
+
+// setPrefix adds or removes a membership prefix symbol of a member, keeping the symbols in the server's order.
+func (m *membership) setPrefix(conn *irc.Connection, channel, nick string, symbol byte, adding bool, order string) {
+	m.Lock()
+	defer m.Unlock()
+
+	state, ok := m.channels[conn][strings.ToLower(channel)]
+	if !ok {
+		return
+	}
+	mem, ok := state.members[strings.ToLower(nick)]
+	if !ok {
+		return
+	}
+
+	prefixes := strings.ReplaceAll(mem.Prefixes, string(symbol), "")
+	if adding {
+		prefixes += string(symbol)
+	}
+	mem.Prefixes = orderPrefixes(prefixes, order)
+}
+
+// orderPrefixes returns the prefix symbols sorted in the server's order, highest rank first, without duplicates.
+func orderPrefixes(prefixes, order string) string {
+	var ordered strings.Builder
+	for i := 0; i < len(order); i++ {
+		if strings.IndexByte(prefixes, order[i]) >= 0 {
+			ordered.WriteByte(order[i])
+		}
+	}
+	return ordered.String()
+}
+
+// prefixes returns the membership prefix symbols of a member, empty if the member isn't known.
+func (m *membership) prefixes(conn *irc.Connection, channel, nick string) string {
+	m.Lock()
+	defer m.Unlock()
+	state, ok := m.channels[conn][strings.ToLower(channel)]
+	if !ok {
+		return ""
+	}
+	if mem, ok := state.members[strings.ToLower(nick)]; ok {
+		return mem.Prefixes
+	}
+	return ""
+}
+
+// lookup returns the nick of a channel member as the server knows it, and whether the member is on the channel.
+func (m *membership) lookup(conn *irc.Connection, channel, nick string) (string, bool) {
+	m.Lock()
+	defer m.Unlock()
+	state, ok := m.channels[conn][strings.ToLower(channel)]
+	if !ok {
+		return "", false
+	}
+	mem, ok := state.members[strings.ToLower(nick)]
+	if !ok {
+		return "", false
+	}
+	return mem.Nick, true
+}
+
+// isOn reports whether the bot is on a channel.
+func (m *membership) isOn(conn *irc.Connection, channel string) bool {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.channels[conn][strings.ToLower(channel)]
+	return ok
+}
+
+// emptyChannels returns the channels that have had only the bot on them for at least the given duration.
+func (m *membership) emptyChannels(conn *irc.Connection, after time.Duration) []string {
+	m.Lock()
+	defer m.Unlock()
+
+	var channels []string
+	for name, state := range m.channels[conn] {
+		if !state.emptySince.IsZero() && m.clock.Now().Sub(state.emptySince) >= after {
+			channels = append(channels, name)
+		}
+	}
+	return channels
+}
+
+// emptyChannelStops stop the empty channel check of each connection once the bot is done with it
+var (
+	emptyChannelStopsMutex sync.Mutex
+	emptyChannelStops      = map[*irc.Connection]chan struct{}{}
+)
+
+// emptyChannelStop returns the channel that is closed when the connection's empty channel check should stop.
+func emptyChannelStop(conn *irc.Connection) <-chan struct{} {
+	emptyChannelStopsMutex.Lock()
+	defer emptyChannelStopsMutex.Unlock()
+	if stop, ok := emptyChannelStops[conn]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	emptyChannelStops[conn] = stop
+	return stop
+}
+
+// stopEmptyChannelCheck stops the empty channel check of a connection.
+func stopEmptyChannelCheck(conn *irc.Connection) {
+	emptyChannelStopsMutex.Lock()
+	defer emptyChannelStopsMutex.Unlock()
+	if stop, ok := emptyChannelStops[conn]; ok {
+		close(stop)
+		delete(emptyChannelStops, conn)
+	}
+}
+
+// partEmptyChannels periodically leaves channels that have been empty for longer than the configured timeout,
+// until stop is closed.
+func partEmptyChannels(config *Config, conn *irc.Connection, stop <-chan struct{}) {
+	timeout := time.Duration(config.EmptyChannelTimeout)
+	if timeout <= 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-members.clock.After(time.Minute):
+		}
+		for _, channel := range members.emptyChannels(conn, timeout) {
+			connections.logger(conn).Info("Leaving empty channel", "channel", channel, "emptyFor", timeout)
+			conn.Part(channel)
+			members.clear(conn, channel)
+		}
+	}
+}
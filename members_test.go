@@ -0,0 +1,152 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func newTestMembership(clock Clock) *membership {
+	return &membership{clock: clock, channels: make(map[*irc.Connection]map[string]*channelState)}
+}
+
+func TestEmptyChannels(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	m := newTestMembership(clock)
+	conn := irc.IRC("gobot", "gobot")
+	currentNicks.set(conn, "gobot")
+	t.Cleanup(func() { currentNicks.remove(conn) })
+
+	m.join(conn, "#quiet", "gobot", "")
+	m.join(conn, "#busy", "gobot", "")
+	m.join(conn, "#busy", "alice", "")
+	m.join(conn, "#left", "gobot", "")
+	m.join(conn, "#left", "bob", "")
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	m.part(conn, "#left", "bob")
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		after   time.Duration
+		want    []string
+	}{
+		{name: "only the bot for long enough", after: 10 * time.Minute, want: []string{"#quiet"}},
+		{name: "not empty long enough yet", after: 11 * time.Minute, want: nil},
+		{name: "the last member left a while ago", advance: 10 * time.Minute, after: 10 * time.Minute, want: []string{"#left", "#quiet"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = clock.now.Add(tt.advance)
+			got := m.emptyChannels(conn, tt.after)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("emptyChannels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Someone joining makes the channel busy again
+	m.join(conn, "#quiet", "carol", "")
+	if got := m.emptyChannels(conn, 0); !slices.Equal(got, []string{"#left"}) {
+		t.Errorf("emptyChannels() after a join = %v, want [#left]", got)
+	}
+}
+
+func TestOrderPrefixes(t *testing.T) {
+	tests := []struct {
+		prefixes string
+		order    string
+		want     string
+	}{
+		{prefixes: "", order: "@+", want: ""},
+		{prefixes: "+@", order: "@+", want: "@+"},
+		{prefixes: "@@+", order: "@+", want: "@+"},
+		{prefixes: "+%~", order: "~&@%+", want: "~%+"},
+		// Symbols the server doesn't use are dropped
+		{prefixes: "!@", order: "@+", want: "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefixes, func(t *testing.T) {
+			if got := orderPrefixes(tt.prefixes, tt.order); got != tt.want {
+				t.Errorf("orderPrefixes(%q, %q) = %q, want %q", tt.prefixes, tt.order, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamesMultiPrefix(t *testing.T) {
+	conn := newISupportConn(t, "PREFIX=(qaohv)~&@%+")
+	t.Cleanup(func() { members.reset(conn) })
+	trackMembers(conn)
+
+	conn.RunCallbacks(&irc.Event{Code: "353", Arguments: []string{"gobot", "=", "#go", "~@alice +@bob %carol dave"}})
+
+	tests := []struct {
+		nick string
+		want string
+	}{
+		{nick: "alice", want: "~@"},
+		// Kept in the server's order whatever order they were listed in
+		{nick: "bob", want: "@+"},
+		{nick: "carol", want: "%"},
+		{nick: "dave", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nick, func(t *testing.T) {
+			if got := members.prefixes(conn, "#go", tt.nick); got != tt.want {
+				t.Errorf("prefixes(%q) = %q, want %q", tt.nick, got, tt.want)
+			}
+		})
+	}
+
+	if !isWantedCap("multi-prefix") {
+		t.Error("multi-prefix is not requested")
+	}
+}
+
+func TestEmptyChannelCheckStopsOnClose(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	config := &Config{EmptyChannelTimeout: Duration(time.Hour)}
+
+	stop := emptyChannelStop(conn)
+	done := make(chan struct{})
+	go func() {
+		partEmptyChannels(config, conn, stop)
+		close(done)
+	}()
+
+	publish(EventClosed, config, conn, nil)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("empty channel check kept running after the connection was closed")
+	}
+
+	emptyChannelStopsMutex.Lock()
+	_, ok := emptyChannelStops[conn]
+	emptyChannelStopsMutex.Unlock()
+	if ok {
+		t.Error("stop of a closed connection is still kept")
+	}
+}
+
+func TestEmptyChannelCheckRestarts(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	t.Cleanup(func() { stopEmptyChannelCheck(conn) })
+
+	// Setting up the connection again stops the check started before
+	first := emptyChannelStop(conn)
+	emptyChannelStop(conn)
+	select {
+	case <-first:
+	default:
+		t.Error("earlier check was not stopped")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// modeChange is a single mode set or unset by a MODE message.
+type modeChange struct {
+	Adding bool
+	Mode   byte
+	Param  string
+}
+
+func init() {
+	registerFeature("mode", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("MODE", func(e *irc.Event) {
+			handleMode(config, conn, e)
+		})
+	})
+}
+
+// parseModeChanges splits the mode string and parameters of a channel MODE message into single changes.
+// The server's PREFIX and CHANMODES tell which modes take a parameter.
+func parseModeChanges(conn *irc.Connection, args []string) []modeChange {
+	if len(args) == 0 {
+		return nil
+	}
+	prefixModes, _ := prefixSymbols(conn)
+	list, always, whenSet, _ := chanModes(conn)
+
+	var changes []modeChange
+	params := args[1:]
+	adding := true
+	for i := 0; i < len(args[0]); i++ {
+		mode := args[0][i]
+		switch mode {
+		case '+':
+			adding = true
+			continue
+		case '-':
+			adding = false
+			continue
+		}
+
+		change := modeChange{Adding: adding, Mode: mode}
+		takesParam := strings.IndexByte(prefixModes+list+always, mode) >= 0 ||
+			(adding && strings.IndexByte(whenSet, mode) >= 0)
+		if takesParam && len(params) > 0 {
+			change.Param, params = params[0], params[1:]
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// handleMode keeps the membership prefixes up to date when channel modes change.
+// MODE "<channel> <modestring> <params>..."
+func handleMode(config *Config, conn *irc.Connection, e *irc.Event) {
+	if len(e.Arguments) < 2 {
+		return
+	}
+	channel := e.Arguments[0]
+	// User modes of the bot itself aren't interesting here
+	if channel == "" || !strings.ContainsRune(chanTypes(conn), rune(channel[0])) {
+		return
+	}
+
+	modes, symbols := prefixSymbols(conn)
+	for _, change := range parseModeChanges(conn, e.Arguments[1:]) {
+		i := strings.IndexByte(modes, change.Mode)
+		if i < 0 || change.Param == "" {
+			continue
+		}
+		members.setPrefix(conn, channel, change.Param, symbols[i], change.Adding, symbols)
+
+		if strings.EqualFold(change.Param, botNick(conn)) {
+			slog.Info("Bot channel mode changed", "channel", channel, "mode", modeString(change), "by", e.Nick)
+			if change.Mode == 'o' && !change.Adding {
+				requestOps(config, conn, channel)
+			}
+		}
+	}
+}
+
+// modeString formats a change the way it appears in a mode string, e.g. "+o".
+func modeString(change modeChange) string {
+	if change.Adding {
+		return "+" + string(change.Mode)
+	}
+	return "-" + string(change.Mode)
+}
+
+// hasOps reports whether nick has channel operator status or higher on a channel according to the membership cache.
+func hasOps(conn *irc.Connection, channel, nick string) bool {
+	modes, symbols := prefixSymbols(conn)
+	// PREFIX lists the modes from the highest rank down, everything up to +o counts
+	i := strings.IndexByte(modes, 'o')
+	if i < 0 {
+		return false
+	}
+	return strings.ContainsAny(members.prefixes(conn, channel, nick), symbols[:i+1])
+}
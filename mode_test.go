@@ -0,0 +1,118 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestParseModeChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		args   []string
+		want   []modeChange
+	}{
+		{name: "no mode string"},
+		{
+			name: "op and voice",
+			args: []string{"+ov", "alice", "bob"},
+			want: []modeChange{{Adding: true, Mode: 'o', Param: "alice"}, {Adding: true, Mode: 'v', Param: "bob"}},
+		},
+		{
+			name: "mixed signs",
+			args: []string{"+o-v+m", "alice", "bob"},
+			want: []modeChange{{Adding: true, Mode: 'o', Param: "alice"}, {Adding: false, Mode: 'v', Param: "bob"}, {Adding: true, Mode: 'm'}},
+		},
+		{
+			name: "list and key modes",
+			args: []string{"+bk", "*!*@spam", "secret"},
+			want: []modeChange{{Adding: true, Mode: 'b', Param: "*!*@spam"}, {Adding: true, Mode: 'k', Param: "secret"}},
+		},
+		{
+			name: "limit only takes a parameter when set",
+			args: []string{"-l+l", "10"},
+			want: []modeChange{{Adding: false, Mode: 'l'}, {Adding: true, Mode: 'l', Param: "10"}},
+		},
+		{
+			name: "missing parameters",
+			args: []string{"+oo", "alice"},
+			want: []modeChange{{Adding: true, Mode: 'o', Param: "alice"}, {Adding: true, Mode: 'o'}},
+		},
+		{
+			name:   "advertised modes",
+			tokens: []string{"PREFIX=(qaohv)~&@%+", "CHANMODES=beI,k,fl,imnpst"},
+			args:   []string{"+hf", "alice", "[5t]:10"},
+			want:   []modeChange{{Adding: true, Mode: 'h', Param: "alice"}, {Adding: true, Mode: 'f', Param: "[5t]:10"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseModeChanges(newISupportConn(t, tt.tokens...), tt.args)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseModeChanges(%q) = %+v, want %+v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModeString(t *testing.T) {
+	if got := modeString(modeChange{Adding: true, Mode: 'o'}); got != "+o" {
+		t.Errorf("modeString() = %q, want +o", got)
+	}
+	if got := modeString(modeChange{Mode: 'v'}); got != "-v" {
+		t.Errorf("modeString() = %q, want -v", got)
+	}
+}
+
+func TestHandleModeUpdatesPrefixes(t *testing.T) {
+	conn := newISupportConn(t)
+	currentNicks.set(conn, "gobot")
+	t.Cleanup(func() {
+		currentNicks.remove(conn)
+		members.reset(conn)
+	})
+	members.join(conn, "#go", "alice", "")
+	members.join(conn, "#go", "bob", "@")
+
+	handleMode(&Config{}, conn, &irc.Event{Code: "MODE", Nick: "ChanServ", Arguments: []string{"#go", "+o-o+v", "alice", "bob", "bob"}})
+
+	if !hasOps(conn, "#go", "alice") {
+		t.Error("alice has no ops after +o")
+	}
+	if hasOps(conn, "#go", "bob") {
+		t.Error("bob still has ops after -o")
+	}
+	if got := members.prefixes(conn, "#go", "bob"); got != "+" {
+		t.Errorf("bob's prefixes = %q, want +", got)
+	}
+
+	// User modes are not channel modes
+	handleMode(&Config{}, conn, &irc.Event{Code: "MODE", Nick: "gobot", Arguments: []string{"alice", "-o", "alice"}})
+	if !hasOps(conn, "#go", "alice") {
+		t.Error("a user mode change removed channel ops")
+	}
+}
+
+func TestChanModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		want   [4]string
+	}{
+		{name: "default", want: [4]string{"beI", "k", "l", "imnpst"}},
+		{name: "advertised", tokens: []string{"CHANMODES=beIq,k,flj,CFLMPQcgimnprstz"}, want: [4]string{"beIq", "k", "flj", "CFLMPQcgimnprstz"}},
+		{name: "missing types", tokens: []string{"CHANMODES=b,k"}, want: [4]string{"b", "k", "", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, always, whenSet, never := chanModes(newISupportConn(t, tt.tokens...))
+			if got := [4]string{list, always, whenSet, never}; got != tt.want {
+				t.Errorf("chanModes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// netsplitMemory is how long nicks lost in a netsplit are remembered while waiting for them to return
+const netsplitMemory = 30 * time.Minute
+
+// netsplit is a single split between two servers.
+type netsplit struct {
+	started time.Time
+	// lowercase nicks that quit in the split
+	nicks map[string]bool
+}
+
+// netsplits tracks ongoing netsplits per connection, keyed by the quit message naming the servers.
+type netsplits struct {
+	sync.Mutex
+	clock  Clock
+	splits map[*irc.Connection]map[string]*netsplit
+}
+
+var splits = &netsplits{clock: defaultClock, splits: make(map[*irc.Connection]map[string]*netsplit)}
+
+func init() {
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		splits.reset(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		splits.reset(conn)
+	})
+
+	// Servers with the batch capability group the quits and joins of a netsplit themselves
+	onBatch("netsplit", func(config *Config, conn *irc.Connection, batch *ircBatch) {
+		slog.Info("Netsplit", "servers", strings.Join(batch.Params, " "), "quits", len(batch.Events))
+	})
+	onBatch("netjoin", func(config *Config, conn *irc.Connection, batch *ircBatch) {
+		slog.Info("Netsplit over", "servers", strings.Join(batch.Params, " "), "joins", len(batch.Events))
+	})
+
+	registerFeature("netsplit", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("QUIT", func(e *irc.Event) {
+			handleQuit(config, conn, e)
+		})
+		conn.AddCallback("JOIN", func(e *irc.Event) {
+			handleJoin(config, conn, e)
+		})
+	})
+}
+
+// isNetsplitQuit reports whether a quit message is the "server1.net server2.split" style message
+// servers use for users lost in a netsplit.
+func isNetsplitQuit(message string) bool {
+	servers := strings.Split(message, " ")
+	if len(servers) != 2 || servers[0] == servers[1] {
+		return false
+	}
+	for _, server := range servers {
+		// Server names are hostnames, a user could easily type anything else
+		if !strings.Contains(server, ".") || strings.HasPrefix(server, ".") || strings.HasSuffix(server, ".") {
+			return false
+		}
+		if strings.ContainsAny(server, ":/@!") {
+			return false
+		}
+	}
+	return true
+}
+
+// isNetsplitBatch reports whether a message is part of a netsplit or netjoin batch, which are logged as a whole.
+func isNetsplitBatch(conn *irc.Connection, e *irc.Event) bool {
+	batch := batchOf(conn, e)
+	return batch != nil && (batch.Type == "netsplit" || batch.Type == "netjoin")
+}
+
+// handleQuit logs users quitting, netsplits are logged once when suppression is enabled.
+func handleQuit(config *Config, conn *irc.Connection, e *irc.Event) {
+	if isNetsplitBatch(conn, e) {
+		return
+	}
+	if !isNetsplitQuit(e.Message()) {
+		slog.Debug("User quit", "nick", e.Nick, "message", e.Message())
+		return
+	}
+	if !config.SuppressNetsplits {
+		slog.Info("Netsplit quit", "nick", e.Nick, "servers", e.Message())
+		return
+	}
+	if splits.add(conn, e.Message(), e.Nick) {
+		slog.Info("Netsplit detected", "servers", e.Message())
+	}
+}
+
+// handleJoin logs users joining, except for users returning from a netsplit when suppression is enabled.
+func handleJoin(config *Config, conn *irc.Connection, e *irc.Event) {
+	if isNetsplitBatch(conn, e) {
+		return
+	}
+	if config.SuppressNetsplits && splits.rejoin(conn, e.Nick) {
+		return
+	}
+	slog.Debug("User joined", "nick", e.Nick, "channel", e.Message())
+}
+
+// reset forgets the netsplits of a connection.
+func (s *netsplits) reset(conn *irc.Connection) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.splits, conn)
+}
+
+// add records a nick lost in a netsplit and reports whether this is the first quit of the split.
+func (s *netsplits) add(conn *irc.Connection, servers, nick string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire(conn)
+	connSplits, ok := s.splits[conn]
+	if !ok {
+		connSplits = make(map[string]*netsplit)
+		s.splits[conn] = connSplits
+	}
+	split, ok := connSplits[servers]
+	if !ok {
+		split = &netsplit{started: s.clock.Now(), nicks: make(map[string]bool)}
+		connSplits[servers] = split
+	}
+	split.nicks[strings.ToLower(nick)] = true
+	return !ok
+}
+
+// rejoin reports whether a joining nick was lost in a netsplit.
+func (s *netsplits) rejoin(conn *irc.Connection, nick string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire(conn)
+	// Users rejoin every channel they were on, so the nick is kept until the split is forgotten
+	for _, split := range s.splits[conn] {
+		if split.nicks[strings.ToLower(nick)] {
+			return true
+		}
+	}
+	return false
+}
+
+// expire forgets splits older than netsplitMemory. The caller must hold the lock.
+func (s *netsplits) expire(conn *irc.Connection) {
+	for servers, split := range s.splits[conn] {
+		if s.clock.Now().Sub(split.started) >= netsplitMemory {
+			slog.Info("Netsplit forgotten", "servers", servers, "lost", len(split.nicks))
+			delete(s.splits[conn], servers)
+		}
+	}
+}
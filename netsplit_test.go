@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestIsNetsplitQuit(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{message: "irc.example.net hub.example.net", want: true},
+		{message: "*.net *.split", want: true},
+		{message: "Quit: leaving", want: false},
+		{message: "", want: false},
+		{message: "irc.example.net", want: false},
+		{message: "irc.example.net irc.example.net", want: false},
+		{message: "irc.example.net  hub.example.net", want: false},
+		{message: "a.b c.d e.f", want: false},
+		{message: "see you.", want: false},
+		{message: ".hidden example.net", want: false},
+		{message: "https://example.com bye.now", want: false},
+		{message: "user@example.net hub.example.net", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := isNetsplitQuit(tt.message); got != tt.want {
+				t.Errorf("isNetsplitQuit(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetsplits(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	clock := &manualClock{now: time.Unix(0, 0)}
+	s := &netsplits{clock: clock, splits: make(map[*irc.Connection]map[string]*netsplit)}
+
+	if !s.add(conn, "a.net b.net", "alice") {
+		t.Error("first quit of the split was not reported")
+	}
+	if s.add(conn, "a.net b.net", "Bob") {
+		t.Error("second quit of the split was reported as a new split")
+	}
+	clock.advance(netsplitMemory / 2)
+	if !s.add(conn, "c.net d.net", "carol") {
+		t.Error("quit of another split was not reported")
+	}
+
+	for nick, want := range map[string]bool{"alice": true, "BOB": true, "carol": true, "dave": false} {
+		if got := s.rejoin(conn, nick); got != want {
+			t.Errorf("rejoin(%q) = %v, want %v", nick, got, want)
+		}
+	}
+	// Nicks are remembered for every channel they rejoin
+	if !s.rejoin(conn, "alice") {
+		t.Error("nick was forgotten after the first rejoin")
+	}
+
+	// Other connections have their own splits
+	if s.rejoin(irc.IRC("gobot", "gobot"), "alice") {
+		t.Error("nick lost on another connection was rejoined")
+	}
+
+	clock.advance(netsplitMemory / 2)
+	if s.rejoin(conn, "alice") {
+		t.Error("nick of an expired split was rejoined")
+	}
+	if !s.rejoin(conn, "carol") {
+		t.Error("nick of an ongoing split was forgotten")
+	}
+
+	s.reset(conn)
+	if s.rejoin(conn, "carol") {
+		t.Error("nick was rejoined after a reset")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// connectionRegistry maps configured network names to their IRC connections.
+type connectionRegistry struct {
+	sync.Mutex
+	byName  map[string]*irc.Connection
+	names   map[*irc.Connection]string
+	loggers map[*irc.Connection]*slog.Logger
+}
+
+var connections = &connectionRegistry{
+	byName:  make(map[string]*irc.Connection),
+	names:   make(map[*irc.Connection]string),
+	loggers: make(map[*irc.Connection]*slog.Logger),
+}
+
+// add registers the connection of a network and the logger scoped to it.
+func (r *connectionRegistry) add(name string, conn *irc.Connection, logger *slog.Logger) {
+	r.Lock()
+	defer r.Unlock()
+	r.byName[name] = conn
+	r.names[conn] = name
+	r.loggers[conn] = logger
+}
+
+// remove forgets a connection that is no longer used.
+func (r *connectionRegistry) remove(conn *irc.Connection) {
+	r.Lock()
+	defer r.Unlock()
+	if name, ok := r.names[conn]; ok && r.byName[name] == conn {
+		delete(r.byName, name)
+	}
+	delete(r.names, conn)
+	delete(r.loggers, conn)
+}
+
+// get returns the connection of a network.
+func (r *connectionRegistry) get(name string) (*irc.Connection, bool) {
+	r.Lock()
+	defer r.Unlock()
+	conn, ok := r.byName[name]
+	return conn, ok
+}
+
+// name returns the network name of a connection.
+func (r *connectionRegistry) name(conn *irc.Connection) string {
+	r.Lock()
+	defer r.Unlock()
+	return r.names[conn]
+}
+
+// logger returns the logger of a connection, which adds the network to every record.
+func (r *connectionRegistry) logger(conn *irc.Connection) *slog.Logger {
+	r.Lock()
+	defer r.Unlock()
+	if logger, ok := r.loggers[conn]; ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// normalizeChannel adds the # prefix to channel names configured without one.
+// The channel types the server advertised are used when conn is known.
+func normalizeChannel(conn *irc.Connection, channel string) string {
+	types := defaultChanTypes
+	if conn != nil {
+		types = chanTypes(conn)
+	}
+	if channel == "" || !strings.ContainsRune(types, rune(channel[0])) {
+		return "#" + channel
+	}
+	return channel
+}
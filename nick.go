@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	// defaultNickRecoveryInterval is how often the bot tries to take back the configured nick by default
+	defaultNickRecoveryInterval = time.Minute
+	// defaultNickRecoveryAttempts is how many times the bot tries to take back the configured nick by default
+	defaultNickRecoveryAttempts = 10
+	// defaultMaxNickAttempts is how many alternative nicks are tried by default
+	defaultMaxNickAttempts = 5
+)
+
+// nickTracker follows the nick the bot currently has on each connection.
+// The IRC library updates its own copy concurrently with our callbacks, so it can't be used to tell which nick was changed.
+type nickTracker struct {
+	sync.Mutex
+	current map[*irc.Connection]string
+}
+
+var currentNicks = &nickTracker{current: make(map[*irc.Connection]string)}
+
+// nickAttempts counts the alternative nicks tried on each connection since it last registered
+var (
+	nickAttemptsMutex sync.Mutex
+	nickAttempts      = map[*irc.Connection]int{}
+)
+
+// nickRecovery periodically tries to take back the configured nick after the bot ended up with another one.
+type nickRecovery struct {
+	timer    Timer
+	attempts int
+}
+
+var (
+	nickRecoveriesMutex sync.Mutex
+	nickRecoveries      = map[*irc.Connection]*nickRecovery{}
+)
+
+func init() {
+	subscribe(EventConnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		if len(e.Arguments) > 0 {
+			currentNicks.set(conn, e.Arguments[0])
+		}
+		resetNickAttempts(conn)
+		// Registered with an alternative nick because the configured one was taken
+		if len(e.Arguments) > 0 && !strings.EqualFold(e.Arguments[0], desiredNick(config, conn)) {
+			startNickRecovery(config, conn)
+		}
+	})
+	// A reconnect starts over with the configured nick
+	subscribe(EventDisconnected, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		resetNickAttempts(conn)
+		stopNickRecovery(conn)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		currentNicks.remove(conn)
+		resetNickAttempts(conn)
+		stopNickRecovery(conn)
+	})
+
+	registerFeature("nick", func(config *Config, conn *irc.Connection) {
+		conn.AddCallback("NICK", func(e *irc.Event) {
+			handleNickChange(config, conn, e)
+		})
+
+		// Replace the fallbacks of the IRC library, which don't know about NICKLEN
+		for _, code := range []string{"433", "437"} {
+			conn.ClearCallback(code)
+			conn.AddCallback(code, func(e *irc.Event) {
+				handleNickInUse(config, conn, e)
+			})
+		}
+	})
+}
+
+func (t *nickTracker) set(conn *irc.Connection, nick string) {
+	t.Lock()
+	defer t.Unlock()
+	t.current[conn] = nick
+}
+
+func (t *nickTracker) get(conn *irc.Connection) string {
+	t.Lock()
+	defer t.Unlock()
+	return t.current[conn]
+}
+
+func (t *nickTracker) remove(conn *irc.Connection) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.current, conn)
+}
+
+// botNick returns the nick the bot has on a connection.
+// The IRC library doesn't follow every change of the bot's nick, so its own copy is only used before registration.
+func botNick(conn *irc.Connection) string {
+	if nick := currentNicks.get(conn); nick != "" {
+		return nick
+	}
+	return conn.GetNick()
+}
+
+func resetNickAttempts(conn *irc.Connection) {
+	nickAttemptsMutex.Lock()
+	defer nickAttemptsMutex.Unlock()
+	delete(nickAttempts, conn)
+}
+
+// desiredNick returns the nick the bot should have on a connection.
+func desiredNick(config *Config, conn *irc.Connection) string {
+	return config.nickname(config.Networks[connections.name(conn)])
+}
+
+// alternativeNick returns the nick to try on the given attempt after nick was rejected: first with "_",
+// then with "__" and after that with a random number from intN, keeping it within maxLength if that's known.
+func alternativeNick(nick string, attempt, maxLength int, intN func(n int) int) string {
+	var suffix string
+	switch attempt {
+	case 1:
+		suffix = "_"
+	case 2:
+		suffix = "__"
+	default:
+		suffix = fmt.Sprintf("%03d", intN(1000))
+	}
+
+	// No room to grow, replace the end of the nick instead
+	if maxLength > 0 && len(nick)+len(suffix) > maxLength {
+		nick = nick[:max(maxLength-len(suffix), 1)]
+	}
+	return nick + suffix
+}
+
+// handleNickInUse tries an alternative nick when the one the bot asked for while registering is taken or unavailable.
+// 433: ERR_NICKNAMEINUSE "<client> <nick> :Nickname is already in use"
+// 437: ERR_UNAVAILRESOURCE "<client> <nick> :Nick/channel is temporarily unavailable"
+func handleNickInUse(config *Config, conn *irc.Connection, e *irc.Event) {
+	// 437 is also sent for channels that can't be joined
+	if len(e.Arguments) < 2 || e.Arguments[1] == "" || strings.ContainsRune(chanTypes(conn), rune(e.Arguments[1][0])) {
+		return
+	}
+	// Once registered the bot already has a nick, this is a failed attempt to change it
+	if e.Arguments[0] != "*" {
+		slog.Warn("Nick is not available", "nick", e.Arguments[1])
+		// Have services free the configured nick for the next recovery attempt
+		if strings.EqualFold(e.Arguments[1], desiredNick(config, conn)) {
+			command := "GHOST"
+			if e.Code == "437" {
+				command = "RELEASE"
+			}
+			freeNick(config, conn, command, e.Arguments[1])
+		}
+		return
+	}
+
+	maxAttempts := config.MaxNickAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxNickAttempts
+	}
+	nickAttemptsMutex.Lock()
+	nickAttempts[conn]++
+	attempt := nickAttempts[conn]
+	nickAttemptsMutex.Unlock()
+
+	if attempt > maxAttempts {
+		slog.Error("No alternative nick is available, giving up", "nick", desiredNick(config, conn), "attempts", maxAttempts)
+		return
+	}
+
+	// NICKLEN is only known after the first registration, reconnects still have the earlier value
+	nick := alternativeNick(desiredNick(config, conn), attempt, isupportInt(conn, "NICKLEN"), rand.IntN)
+	slog.Warn("Nick is not available, trying another", "nick", e.Arguments[1], "alternative", nick, "attempt", attempt)
+	conn.SendRawf("NICK %s", nick)
+}
+
+// handleNickChange notices when the bot's nick is changed for it, e.g. by services enforcing a registered nick.
+func handleNickChange(config *Config, conn *irc.Connection, e *irc.Event) {
+	if !strings.EqualFold(e.Nick, botNick(conn)) {
+		return
+	}
+	newNick := e.Message()
+	currentNicks.set(conn, newNick)
+
+	desired := desiredNick(config, conn)
+	if strings.EqualFold(newNick, desired) {
+		slog.Info("Nick changed", "nick", newNick)
+		stopNickRecovery(conn)
+		return
+	}
+
+	slog.Warn("Nick was changed", "from", e.Nick, "to", newNick)
+	verifyChannels(config, conn)
+	startNickRecovery(config, conn)
+}
+
+// nickRecoverySettings returns how often and how many times the configured nick is reclaimed,
+// an interval of 0 means recovery is off.
+func nickRecoverySettings(config *Config) (interval time.Duration, attempts int) {
+	interval = time.Duration(config.NickRecoveryInterval)
+	if interval == 0 {
+		interval = defaultNickRecoveryInterval
+	} else if interval < 0 {
+		interval = 0
+	}
+	attempts = config.NickRecoveryAttempts
+	if attempts <= 0 {
+		attempts = defaultNickRecoveryAttempts
+	}
+	return interval, attempts
+}
+
+// startNickRecovery starts trying to take back the configured nick, unless that's already going on.
+func startNickRecovery(config *Config, conn *irc.Connection) {
+	interval, maxAttempts := nickRecoverySettings(config)
+	if interval == 0 {
+		return
+	}
+
+	nickRecoveriesMutex.Lock()
+	defer nickRecoveriesMutex.Unlock()
+	if _, ok := nickRecoveries[conn]; ok {
+		return
+	}
+
+	recovery := &nickRecovery{}
+	var attempt func()
+	attempt = func() {
+		desired := desiredNick(config, conn)
+
+		nickRecoveriesMutex.Lock()
+		defer nickRecoveriesMutex.Unlock()
+		if nickRecoveries[conn] != recovery {
+			return
+		}
+		current := botNick(conn)
+		if !recovery.next(current, desired, maxAttempts) {
+			if !strings.EqualFold(current, desired) {
+				slog.Warn("Could not regain nick, giving up", "nick", desired, "attempts", recovery.attempts)
+			}
+			delete(nickRecoveries, conn)
+			return
+		}
+
+		slog.Info("Trying to regain nick", "nick", desired, "attempt", recovery.attempts)
+		conn.SendRawf("NICK %s", desired)
+		recovery.timer = defaultClock.AfterFunc(interval, attempt)
+	}
+	recovery.timer = defaultClock.AfterFunc(interval, attempt)
+	nickRecoveries[conn] = recovery
+}
+
+// next counts another attempt to take back the desired nick.
+// It reports false when the bot already has the nick or the attempts have run out.
+func (r *nickRecovery) next(current, desired string, maxAttempts int) bool {
+	if strings.EqualFold(current, desired) || r.attempts >= maxAttempts {
+		return false
+	}
+	r.attempts++
+	return true
+}
+
+// stopNickRecovery stops trying to take back the configured nick.
+func stopNickRecovery(conn *irc.Connection) {
+	nickRecoveriesMutex.Lock()
+	defer nickRecoveriesMutex.Unlock()
+	if recovery, ok := nickRecoveries[conn]; ok {
+		recovery.timer.Stop()
+		delete(nickRecoveries, conn)
+	}
+}
+
+// verifyChannels rejoins the configured channels the bot is not on according to the membership cache.
+func verifyChannels(config *Config, conn *irc.Connection) {
+	network, ok := config.Networks[connections.name(conn)]
+	if !ok {
+		return
+	}
+	for _, channel := range network.Channels {
+		channel = normalizeChannel(conn, channel)
+		if !members.isOn(conn, channel) && !bans.has(conn, channel) {
+			slog.Warn("Not on channel anymore, rejoining", "channel", channel)
+			joinChannel(config, conn, channel)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestHandleNickChange(t *testing.T) {
+	config := &Config{Nickname: "gobot", NickRecoveryInterval: Duration(time.Hour)}
+
+	tests := []struct {
+		name       string
+		current    string
+		event      *irc.Event
+		wantNick   string
+		wantActive bool
+	}{
+		{
+			name:       "forced by services",
+			current:    "gobot",
+			event:      &irc.Event{Code: "NICK", Nick: "gobot", Arguments: []string{"Guest123"}},
+			wantNick:   "Guest123",
+			wantActive: true,
+		},
+		{
+			name:       "back to the configured nick",
+			current:    "Guest123",
+			event:      &irc.Event{Code: "NICK", Nick: "Guest123", Arguments: []string{"gobot"}},
+			wantNick:   "gobot",
+			wantActive: false,
+		},
+		{
+			name:       "someone else",
+			current:    "gobot",
+			event:      &irc.Event{Code: "NICK", Nick: "other", Arguments: []string{"other_"}},
+			wantNick:   "gobot",
+			wantActive: false,
+		},
+		{
+			name:       "case differs from the tracked nick",
+			current:    "GoBot",
+			event:      &irc.Event{Code: "NICK", Nick: "gobot", Arguments: []string{"Guest1"}},
+			wantNick:   "Guest1",
+			wantActive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := irc.IRC("gobot", "gobot")
+			currentNicks.set(conn, tt.current)
+			t.Cleanup(func() { stopNickRecovery(conn) })
+
+			handleNickChange(config, conn, tt.event)
+
+			if got := botNick(conn); got != tt.wantNick {
+				t.Errorf("botNick() = %q, want %q", got, tt.wantNick)
+			}
+			nickRecoveriesMutex.Lock()
+			_, active := nickRecoveries[conn]
+			nickRecoveriesMutex.Unlock()
+			if active != tt.wantActive {
+				t.Errorf("recovery active = %v, want %v", active, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestBotNick(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	if got := botNick(conn); got != "gobot" {
+		t.Errorf("botNick() before registration = %q, want %q", got, "gobot")
+	}
+
+	// The library's copy is not updated for every change
+	currentNicks.set(conn, "gobot_")
+	if got := botNick(conn); got != "gobot_" {
+		t.Errorf("botNick() after a change = %q, want %q", got, "gobot_")
+	}
+}
+
+func TestNickRecoveryNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		attempts int
+		want     bool
+		wantLeft int
+	}{
+		{name: "first attempt", current: "gobot_", attempts: 0, want: true, wantLeft: 1},
+		{name: "later attempt", current: "gobot_", attempts: 9, want: true, wantLeft: 10},
+		{name: "attempts used up", current: "gobot_", attempts: 10, want: false, wantLeft: 10},
+		{name: "nick regained", current: "gobot", attempts: 3, want: false, wantLeft: 3},
+		{name: "nick regained with another case", current: "GoBot", attempts: 0, want: false, wantLeft: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recovery := &nickRecovery{attempts: tt.attempts}
+			if got := recovery.next(tt.current, "gobot", 10); got != tt.want {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+			if recovery.attempts != tt.wantLeft {
+				t.Errorf("attempts = %d, want %d", recovery.attempts, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestNickRecoverySettings(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		wantInterval time.Duration
+		wantAttempts int
+	}{
+		{name: "defaults", wantInterval: defaultNickRecoveryInterval, wantAttempts: defaultNickRecoveryAttempts},
+		{
+			name:         "configured",
+			config:       Config{NickRecoveryInterval: Duration(30 * time.Second), NickRecoveryAttempts: 3},
+			wantInterval: 30 * time.Second,
+			wantAttempts: 3,
+		},
+		{name: "off", config: Config{NickRecoveryInterval: Duration(-1)}, wantInterval: 0, wantAttempts: defaultNickRecoveryAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, attempts := nickRecoverySettings(&tt.config)
+			if interval != tt.wantInterval || attempts != tt.wantAttempts {
+				t.Errorf("nickRecoverySettings() = %v, %d, want %v, %d", interval, attempts, tt.wantInterval, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestStartNickRecovery(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	currentNicks.set(conn, "gobot")
+
+	// The bot already has its nick when the timer fires, so nothing is sent
+	startNickRecovery(&Config{Nickname: "gobot", NickRecoveryInterval: Duration(time.Millisecond)}, conn)
+	deadline := time.Now().Add(time.Second)
+	for {
+		nickRecoveriesMutex.Lock()
+		_, active := nickRecoveries[conn]
+		nickRecoveriesMutex.Unlock()
+		if !active {
+			break
+		}
+		if time.Now().After(deadline) {
+			stopNickRecovery(conn)
+			t.Fatal("recovery did not stop after the nick was regained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Recovery is off
+	startNickRecovery(&Config{Nickname: "gobot", NickRecoveryInterval: Duration(-1)}, conn)
+	nickRecoveriesMutex.Lock()
+	_, active := nickRecoveries[conn]
+	nickRecoveriesMutex.Unlock()
+	if active {
+		stopNickRecovery(conn)
+		t.Error("recovery started although it is off")
+	}
+}
+
+func TestAlternativeNick(t *testing.T) {
+	fixed := func(n int) int { return 42 }
+
+	tests := []struct {
+		name      string
+		nick      string
+		attempt   int
+		maxLength int
+		want      string
+	}{
+		{name: "first attempt", nick: "gobot", attempt: 1, want: "gobot_"},
+		{name: "second attempt", nick: "gobot", attempt: 2, want: "gobot__"},
+		{name: "numeric suffix", nick: "gobot", attempt: 3, want: "gobot042"},
+		{name: "fits the limit", nick: "gobot", attempt: 2, maxLength: 7, want: "gobot__"},
+		{name: "truncated to the limit", nick: "gobotlite", attempt: 1, maxLength: 9, want: "gobotlit_"},
+		{name: "numeric suffix truncated", nick: "gobotlite", attempt: 3, maxLength: 9, want: "gobotl042"},
+		{name: "limit shorter than the suffix", nick: "gobot", attempt: 3, maxLength: 2, want: "g042"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := alternativeNick(tt.nick, tt.attempt, tt.maxLength, fixed)
+			if got != tt.want {
+				t.Errorf("alternativeNick(%q, %d, %d) = %q, want %q", tt.nick, tt.attempt, tt.maxLength, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlternativeNickSeeded(t *testing.T) {
+	// The same seed picks the same suffixes
+	seeded := func() func(n int) int { return rand.New(rand.NewPCG(1, 2)).IntN }
+	a, b := seeded(), seeded()
+
+	for attempt := 3; attempt < 10; attempt++ {
+		nickA := alternativeNick("gobot", attempt, 9, a)
+		nickB := alternativeNick("gobot", attempt, 9, b)
+		if nickA != nickB {
+			t.Errorf("attempt %d: %q and %q differ with the same seed", attempt, nickA, nickB)
+		}
+		if len(nickA) != 8 || nickA[:5] != "gobot" {
+			t.Errorf("attempt %d: alternativeNick() = %q, want gobot and three digits", attempt, nickA)
+		}
+	}
+
+	// The suffix is drawn below 1000 so it is always three digits
+	var bounds []int
+	alternativeNick("gobot", 3, 0, func(n int) int {
+		bounds = append(bounds, n)
+		return n - 1
+	})
+	if len(bounds) != 1 || bounds[0] != 1000 {
+		t.Errorf("intN called with %v, want [1000]", bounds)
+	}
+}
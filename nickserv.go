@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log/slog"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// nickServ returns the nick and password of NickServ on the connection's network, empty if the network has none.
+func nickServ(config *Config, conn *irc.Connection) (nick, password string) {
+	network := config.Networks[connections.name(conn)]
+	return network.NickServ, network.NickServPassword
+}
+
+// freeNick asks NickServ to free the bot's registered nick: GHOST disconnects a client that's using it and
+// RELEASE drops the hold services put on it after enforcing. It reports whether NickServ is configured.
+func freeNick(config *Config, conn *irc.Connection, command, nick string) bool {
+	service, password := nickServ(config, conn)
+	if service == "" || password == "" {
+		return false
+	}
+	slog.Info("Asking NickServ to free nick", "command", command, "nick", nick)
+	conn.Privmsgf(service, "%s %s %s", command, nick, password)
+	return true
+}
+
+// identifyNick identifies the bot to NickServ for the configured nick, which also works while
+// the bot is using an alternative nick. It reports whether NickServ is configured.
+func identifyNick(config *Config, conn *irc.Connection) bool {
+	service, password := nickServ(config, conn)
+	if service == "" || password == "" {
+		return false
+	}
+	nick := desiredNick(config, conn)
+	slog.Info("Identifying to NickServ", "nick", nick)
+	conn.Privmsgf(service, "IDENTIFY %s %s", nick, password)
+	return true
+}
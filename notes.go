@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	notesFile        = "notes.json"
+	defaultMaxNotes  = 100
+	defaultMaxLength = 300
+)
+
+// noteStore is a per-channel key/value scratchpad persisted to disk.
+// In private messages each user has a scratchpad of their own.
+type noteStore struct {
+	sync.Mutex
+	loaded bool
+	// network -> lowercase channel or user@host -> key -> value
+	notes map[string]map[string]map[string]string
+}
+
+// noteLimitError rejects a note that is over the configured limits, its message is meant for the user.
+type noteLimitError struct {
+	reason string
+}
+
+func (e *noteLimitError) Error() string { return e.reason }
+
+var notes = &noteStore{}
+
+func init() {
+	registerCommand("note", noteCommand)
+	registerCommand("notes", notesCommand)
+}
+
+// load reads the persisted notes on first use. The caller must hold the lock.
+func (s *noteStore) load(config *Config) error {
+	if s.loaded {
+		return nil
+	}
+	s.notes = make(map[string]map[string]map[string]string)
+	if err := loadJSON(config, notesFile, &s.notes); err != nil {
+		return err
+	}
+	s.loaded = true
+	return nil
+}
+
+// get returns the note stored under key in the scope, a channel or a nick, on the network.
+func (s *noteStore) get(config *Config, network, scope, key string) (string, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return "", false, err
+	}
+	value, ok := s.notes[network][strings.ToLower(scope)][strings.ToLower(key)]
+	return value, ok, nil
+}
+
+// set stores a note, overwriting any earlier value for the same key.
+func (s *noteStore) set(config *Config, network, scope, key, value string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return err
+	}
+
+	maxLength := config.Notes.MaxLength
+	if maxLength == 0 {
+		maxLength = defaultMaxLength
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return &noteLimitError{fmt.Sprintf("note is too long, max %d characters", maxLength)}
+	}
+
+	scope, key = strings.ToLower(scope), strings.ToLower(key)
+	if s.notes[network] == nil {
+		s.notes[network] = make(map[string]map[string]string)
+	}
+	scopeNotes, ok := s.notes[network][scope]
+	if !ok {
+		scopeNotes = make(map[string]string)
+		s.notes[network][scope] = scopeNotes
+	}
+
+	maxNotes := config.Notes.MaxNotes
+	if maxNotes == 0 {
+		maxNotes = defaultMaxNotes
+	}
+	if _, exists := scopeNotes[key]; !exists && s.count() >= maxNotes {
+		return &noteLimitError{fmt.Sprintf("note limit of %d reached", maxNotes)}
+	}
+
+	// Keep memory the same as the file if it can't be written
+	previous, existed := scopeNotes[key]
+	scopeNotes[key] = value
+	if err := saveJSON(config, notesFile, s.notes); err != nil {
+		if existed {
+			scopeNotes[key] = previous
+		} else {
+			delete(scopeNotes, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// keys returns the sorted note keys of a scope on the network.
+func (s *noteStore) keys(config *Config, network, scope string) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range s.notes[network][strings.ToLower(scope)] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// count returns the total number of stored notes. The caller must hold the lock.
+func (s *noteStore) count() int {
+	total := 0
+	for _, networkNotes := range s.notes {
+		for _, scopeNotes := range networkNotes {
+			total += len(scopeNotes)
+		}
+	}
+	return total
+}
+
+// noteScope returns where the notes of a message are kept: its channel, or the sender in private.
+// Senders are known by user@host rather than nick, so whoever takes a nick later can't read its notes.
+func noteScope(conn *irc.Connection, e *irc.Event) string {
+	if isPrivate(conn, e) {
+		return e.User + "@" + e.Host
+	}
+	return e.Arguments[0]
+}
+
+// noteCommand handles ".note <key> <value>" to store and ".note <key>" to retrieve a note.
+func noteCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: note <key> [value]", nil
+	}
+	network, scope, key := connections.name(conn), noteScope(conn, e), args[0]
+
+	if len(args) == 1 {
+		value, ok, err := notes.get(config, network, scope, key)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return fmt.Sprintf("No note for %s", key), nil
+		}
+		return fmt.Sprintf("%s: %s", key, value), nil
+	}
+
+	if err := notes.set(config, network, scope, key, strings.Join(args[1:], " ")); err != nil {
+		var limitErr *noteLimitError
+		if errors.As(err, &limitErr) {
+			return fmt.Sprintf("Could not store note: %s", limitErr), nil
+		}
+		return "Could not store note, try again later", err
+	}
+	return fmt.Sprintf("Noted %s", key), nil
+}
+
+// notesCommand lists the note keys stored for the current channel.
+func notesCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	keys, err := notes.keys(config, connections.name(conn), noteScope(conn, e))
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "No notes stored", nil
+	}
+	return "Notes: " + strings.Join(keys, ", "), nil
+}
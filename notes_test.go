@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestNoteStore(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), Notes: NotesConfig{MaxNotes: 3, MaxLength: 5}}
+	store := &noteStore{}
+
+	steps := []struct {
+		name    string
+		network string
+		scope   string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{name: "set", network: "libera", scope: "#Go", key: "Rules", value: "be ok"},
+		{name: "overwrite", network: "libera", scope: "#go", key: "rules", value: "nice"},
+		{name: "other channel", network: "libera", scope: "#rust", key: "rules", value: "safe"},
+		{name: "same channel on another network", network: "oftc", scope: "#go", key: "rules", value: "other"},
+		{name: "limit reached", network: "oftc", scope: "#go", key: "more", value: "x", wantErr: true},
+		{name: "overwriting is allowed at the limit", network: "oftc", scope: "#go", key: "rules", value: "again"},
+		{name: "length counts characters", network: "libera", scope: "#go", key: "rules", value: "ääääää", wantErr: true},
+	}
+	for _, step := range steps {
+		err := store.set(config, step.network, step.scope, step.key, step.value)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: set() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+	}
+
+	// Five multibyte characters fit in a limit of five
+	if err := store.set(config, "libera", "#go", "rules", "äääää"); err != nil {
+		t.Errorf("set() with multibyte characters error = %v", err)
+	}
+
+	// A fresh store reads the notes back from disk
+	reloaded := &noteStore{}
+	gets := []struct {
+		network, scope, key string
+		want                string
+		wantOK              bool
+	}{
+		{network: "libera", scope: "#GO", key: "RULES", want: "äääää", wantOK: true},
+		{network: "libera", scope: "#rust", key: "rules", want: "safe", wantOK: true},
+		{network: "oftc", scope: "#go", key: "rules", want: "again", wantOK: true},
+		{network: "oftc", scope: "#go", key: "more", wantOK: false},
+		{network: "efnet", scope: "#go", key: "rules", wantOK: false},
+	}
+	for _, get := range gets {
+		value, ok, err := reloaded.get(config, get.network, get.scope, get.key)
+		if err != nil || value != get.want || ok != get.wantOK {
+			t.Errorf("get(%q, %q, %q) = %q, %v, %v, want %q, %v", get.network, get.scope, get.key, value, ok, err, get.want, get.wantOK)
+		}
+	}
+
+	keys, err := reloaded.keys(config, "libera", "#go")
+	if err != nil || !slices.Equal(keys, []string{"rules"}) {
+		t.Errorf("keys() = %v, %v, want [rules]", keys, err)
+	}
+}
+
+func TestNoteScope(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+
+	tests := []struct {
+		name   string
+		target string
+		nick   string
+		want   string
+	}{
+		{name: "channel", target: "#go", nick: "alice", want: "#go"},
+		{name: "private", target: "gobot", nick: "alice", want: "~alice@example.com"},
+		{name: "private with another case", target: "GoBot", nick: "alice", want: "~alice@example.com"},
+		// Someone else using the nick doesn't get the notes
+		{name: "nick taken by someone else", target: "gobot", nick: "alice", want: "~mallory@example.net"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, host, _ := strings.Cut(tt.want, "@")
+			if tt.target == "#go" {
+				user, host = "~alice", "example.com"
+			}
+			e := &irc.Event{Nick: tt.nick, User: user, Host: host, Arguments: []string{tt.target, ".note x"}}
+			if got := noteScope(conn, e); !strings.EqualFold(got, tt.want) {
+				t.Errorf("noteScope() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// breakDataDir makes saving to the data directory of the configuration fail from now on.
+func breakDataDir(t *testing.T, config *Config) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.DataDir = filepath.Join(file, "data")
+}
+
+func TestNoteSetKeepsMemoryOnSaveError(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	store := &noteStore{}
+	if err := store.set(config, "libera", "#go", "rules", "be nice"); err != nil {
+		t.Fatal(err)
+	}
+
+	breakDataDir(t, config)
+	if err := store.set(config, "libera", "#go", "rules", "changed"); err == nil {
+		t.Fatal("set() succeeded without a writable data directory")
+	}
+	if err := store.set(config, "libera", "#go", "new", "note"); err == nil {
+		t.Fatal("set() succeeded without a writable data directory")
+	}
+
+	if value, _, _ := store.get(config, "libera", "#go", "rules"); value != "be nice" {
+		t.Errorf("note = %q after a failed save, want be nice", value)
+	}
+	if _, ok, _ := store.get(config, "libera", "#go", "new"); ok {
+		t.Error("note that wasn't saved is kept")
+	}
+}
+
+func TestNoteCommandErrors(t *testing.T) {
+	previous := notes
+	notes = &noteStore{}
+	t.Cleanup(func() { notes = previous })
+
+	conn := newNetworkConn(t)
+	config := &Config{DataDir: t.TempDir(), Notes: NotesConfig{MaxLength: 5}}
+	e := &irc.Event{Nick: "alice", User: "~alice", Host: "example.com", Arguments: []string{"#go", ".note"}}
+
+	// Limits are explained to the user
+	reply, err := noteCommand(config, conn, e, []string{"rules", "too long"})
+	if err != nil || reply != "Could not store note: note is too long, max 5 characters" {
+		t.Errorf("noteCommand() = %q, %v, want the limit", reply, err)
+	}
+
+	// Other errors are returned for logging, without showing the user where the file is
+	breakDataDir(t, config)
+	reply, err = noteCommand(config, conn, e, []string{"rules", "nice"})
+	if err == nil {
+		t.Error("noteCommand() didn't return the save error")
+	}
+	if reply != "Could not store note, try again later" {
+		t.Errorf("noteCommand() = %q, want the generic reply", reply)
+	}
+}
+
+func TestFailingCommandReplies(t *testing.T) {
+	previous := notes
+	notes = &noteStore{}
+	t.Cleanup(func() { notes = previous })
+
+	conn, lines := newServerConn(t)
+	config := &Config{}
+	breakDataDir(t, config)
+	e := &irc.Event{Code: "PRIVMSG", Nick: "alice", User: "~alice", Host: "example.com", Source: "alice!~alice@example.com", Arguments: []string{"#go", ".note rules nice"}}
+
+	if err := handleCommand(config, conn, discardLogger, e, "note rules nice"); err == nil {
+		t.Error("handleCommand() didn't return the command's error")
+	}
+	if got, want := sentLines(t, conn, lines), []string{"PRIVMSG #go :Could not store note, try again later"}; !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
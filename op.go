@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	registerAdminCommand("op", func(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+		return setOpCommand(conn, e, args, true)
+	})
+	registerAdminCommand("deop", func(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+		return setOpCommand(conn, e, args, false)
+	})
+	registerCommand("access", accessCommand)
+}
+
+// modeNames are the usual names of membership modes, others are shown as the mode letter
+var modeNames = map[byte]string{
+	'q': "owner",
+	'a': "admin",
+	'o': "op",
+	'h': "halfop",
+	'v': "voice",
+}
+
+// describePrefixes names the membership modes of the prefix symbols, e.g. "@+" is "op, voice".
+func describePrefixes(conn *irc.Connection, prefixes string) string {
+	modes, symbols := prefixSymbols(conn)
+	var names []string
+	for i := 0; i < len(prefixes); i++ {
+		j := strings.IndexByte(symbols, prefixes[i])
+		if j < 0 {
+			continue
+		}
+		name, ok := modeNames[modes[j]]
+		if !ok {
+			name = "+" + string(modes[j])
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// accessCommand handles ".access <nick> [#channel]", reporting the channel status of a user from the membership cache.
+func accessCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return "Usage: access <nick> [#channel]", nil
+	}
+	channel := e.Arguments[0]
+	if len(args) == 2 {
+		channel = normalizeChannel(conn, args[1])
+	} else if isPrivate(conn, e) {
+		return "Usage: access <nick> #channel", nil
+	}
+
+	if !members.isOn(conn, channel) {
+		return fmt.Sprintf("I'm not on %s", channel), nil
+	}
+	nick, ok := members.lookup(conn, channel, args[0])
+	if !ok {
+		return fmt.Sprintf("%s is not on %s", args[0], channel), nil
+	}
+	status := describePrefixes(conn, members.prefixes(conn, channel, nick))
+	if status == "" {
+		return fmt.Sprintf("%s has no status on %s", nick, channel), nil
+	}
+	return fmt.Sprintf("%s on %s: %s", nick, channel, status), nil
+}
+
+// setOpCommand handles ".op <nick>" and ".deop <nick>" on the current channel.
+// Only admins can run them, and only on channels where the bot has ops.
+func setOpCommand(conn *irc.Connection, e *irc.Event, args []string, op bool) (string, error) {
+	name := "deop"
+	mode := "-o"
+	if op {
+		name = "op"
+		mode = "+o"
+	}
+
+	if len(args) != 1 {
+		return fmt.Sprintf("Usage: %s <nick>", name), nil
+	}
+	if isPrivate(conn, e) {
+		return fmt.Sprintf("%s only works on a channel", name), nil
+	}
+	channel := e.Arguments[0]
+
+	if !hasOps(conn, channel, botNick(conn)) {
+		return fmt.Sprintf("I don't have ops on %s", channel), nil
+	}
+
+	nick, ok := members.lookup(conn, channel, args[0])
+	if !ok {
+		return fmt.Sprintf("%s is not on %s", args[0], channel), nil
+	}
+
+	conn.Mode(channel, mode, nick)
+	return "", nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// newMembersConn returns a connection where the bot and the given nicks are on #go with their prefixes.
+func newMembersConn(t *testing.T, nicks map[string]string) *irc.Connection {
+	t.Helper()
+	conn := newISupportConn(t)
+	currentNicks.set(conn, "gobot")
+	t.Cleanup(func() {
+		currentNicks.remove(conn)
+		members.reset(conn)
+	})
+	for nick, prefixes := range nicks {
+		members.join(conn, "#go", nick, prefixes)
+	}
+	return conn
+}
+
+func TestSetOpCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		nicks  map[string]string
+		target string
+		args   []string
+		op     bool
+		want   string
+	}{
+		{name: "no nick", nicks: map[string]string{"gobot": "@"}, target: "#go", op: true, want: "Usage: op <nick>"},
+		{name: "too many nicks", nicks: map[string]string{"gobot": "@"}, target: "#go", args: []string{"a", "b"}, want: "Usage: deop <nick>"},
+		{name: "private message", nicks: map[string]string{"gobot": "@"}, target: "gobot", args: []string{"alice"}, op: true, want: "op only works on a channel"},
+		{name: "bot has no ops", nicks: map[string]string{"gobot": "+", "alice": ""}, target: "#go", args: []string{"alice"}, op: true, want: "I don't have ops on #go"},
+		{name: "bot is not on the channel", target: "#go", args: []string{"alice"}, op: true, want: "I don't have ops on #go"},
+		{name: "nick not on the channel", nicks: map[string]string{"gobot": "@"}, target: "#go", args: []string{"alice"}, want: "alice is not on #go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newMembersConn(t, tt.nicks)
+			e := &irc.Event{Code: "PRIVMSG", Nick: "owner", Arguments: []string{tt.target, ".op"}}
+			got, err := setOpCommand(conn, e, tt.args, tt.op)
+			if err != nil {
+				t.Fatalf("setOpCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("setOpCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpCommandsNeedAdmin(t *testing.T) {
+	for _, command := range []string{"op", "deop", "OP"} {
+		if !isAdminCommand(&Config{}, command) {
+			t.Errorf("%s is not an admin command", command)
+		}
+	}
+}
+
+func TestHasOps(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokens   []string
+		prefixes string
+		want     bool
+	}{
+		{name: "op", prefixes: "@", want: true},
+		{name: "op and voice", prefixes: "@+", want: true},
+		{name: "voice", prefixes: "+", want: false},
+		{name: "no status", prefixes: "", want: false},
+		{name: "owner counts", tokens: []string{"PREFIX=(qaohv)~&@%+"}, prefixes: "~", want: true},
+		{name: "halfop doesn't", tokens: []string{"PREFIX=(qaohv)~&@%+"}, prefixes: "%", want: false},
+		{name: "server without ops", tokens: []string{"PREFIX=(v)+"}, prefixes: "+", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newMembersConn(t, nil)
+			isupport.update(conn, tt.tokens)
+			members.join(conn, "#go", "alice", tt.prefixes)
+			if got := hasOps(conn, "#go", "alice"); got != tt.want {
+				t.Errorf("hasOps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribePrefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokens   []string
+		prefixes string
+		want     string
+	}{
+		{name: "none", prefixes: "", want: ""},
+		{name: "op", prefixes: "@", want: "op"},
+		{name: "op and voice", prefixes: "@+", want: "op, voice"},
+		{name: "owner and halfop", tokens: []string{"PREFIX=(qaohv)~&@%+"}, prefixes: "~%", want: "owner, halfop"},
+		{name: "unnamed mode", tokens: []string{"PREFIX=(Yov)!@+"}, prefixes: "!@", want: "+Y, op"},
+		{name: "unknown symbol", prefixes: "~", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newISupportConn(t, tt.tokens...)
+			if got := describePrefixes(conn, tt.prefixes); got != tt.want {
+				t.Errorf("describePrefixes(%q) = %q, want %q", tt.prefixes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessCommand(t *testing.T) {
+	nicks := map[string]string{"gobot": "@", "Alice": "@+", "bob": ""}
+
+	tests := []struct {
+		name   string
+		target string
+		args   []string
+		want   string
+	}{
+		{name: "no nick", target: "#go", want: "Usage: access <nick> [#channel]"},
+		{name: "too many arguments", target: "#go", args: []string{"alice", "#go", "extra"}, want: "Usage: access <nick> [#channel]"},
+		{name: "private without a channel", target: "gobot", args: []string{"alice"}, want: "Usage: access <nick> #channel"},
+		{name: "current channel", target: "#go", args: []string{"alice"}, want: "Alice on #go: op, voice"},
+		{name: "private with a channel", target: "gobot", args: []string{"alice", "go"}, want: "Alice on #go: op, voice"},
+		{name: "no status", target: "#go", args: []string{"bob"}, want: "bob has no status on #go"},
+		{name: "nick not on the channel", target: "#go", args: []string{"carol"}, want: "carol is not on #go"},
+		{name: "bot not on the channel", target: "#go", args: []string{"alice", "#rust"}, want: "I'm not on #rust"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newMembersConn(t, nicks)
+			e := &irc.Event{Code: "PRIVMSG", Nick: "owner", Arguments: []string{tt.target, ".access"}}
+			got, err := accessCommand(&Config{}, conn, e, tt.args)
+			if err != nil {
+				t.Fatalf("accessCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("accessCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
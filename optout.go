@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const optOutsFile = "optouts.json"
+
+// optOutStore keeps the users who asked the bot not to reply to them, persisted to disk.
+type optOutStore struct {
+	sync.Mutex
+	loaded bool
+	// network -> lowercase nick -> opted out
+	nicks map[string]map[string]bool
+}
+
+var optOuts = &optOutStore{}
+
+func init() {
+	registerCommand("ignore", ignoreCommand)
+	registerCommand("unignore", unignoreCommand)
+}
+
+// load reads the persisted opt-outs on first use. The caller must hold the lock.
+func (s *optOutStore) load(config *Config) error {
+	if s.loaded {
+		return nil
+	}
+	s.nicks = make(map[string]map[string]bool)
+	if err := loadJSON(config, optOutsFile, &s.nicks); err != nil {
+		return err
+	}
+	s.loaded = true
+	return nil
+}
+
+// has reports whether nick has opted out of replies on the network.
+func (s *optOutStore) has(config *Config, network, nick string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return false, err
+	}
+	return s.nicks[network][strings.ToLower(nick)], nil
+}
+
+// set opts nick in or out of replies on the network and saves the change.
+func (s *optOutStore) set(config *Config, network, nick string, optedOut bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return err
+	}
+
+	nick = strings.ToLower(nick)
+	if optedOut {
+		if s.nicks[network] == nil {
+			s.nicks[network] = make(map[string]bool)
+		}
+		s.nicks[network][nick] = true
+	} else {
+		delete(s.nicks[network], nick)
+		if len(s.nicks[network]) == 0 {
+			delete(s.nicks, network)
+		}
+	}
+	return saveJSON(config, optOutsFile, s.nicks)
+}
+
+// isOptedOut reports whether the sender of a message has asked the bot not to reply to them.
+// If the opt-outs can't be read the bot replies as usual.
+func isOptedOut(config *Config, conn *irc.Connection, logger *slog.Logger, nick string) bool {
+	optedOut, err := optOuts.has(config, connections.name(conn), nick)
+	if err != nil {
+		logger.Error("Error reading opt-outs", "error", err)
+		return false
+	}
+	return optedOut
+}
+
+// isOptOutCommand reports whether a command is one that users who opted out can still run.
+func isOptOutCommand(command string) bool {
+	return strings.EqualFold(command, "ignore") || strings.EqualFold(command, "unignore")
+}
+
+// ignoreCommand handles ".ignore me", after which the bot doesn't reply to the user's commands or URLs.
+func ignoreCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	if len(args) != 1 || !strings.EqualFold(args[0], "me") {
+		return "Usage: ignore me", nil
+	}
+	if err := optOuts.set(config, connections.name(conn), e.Nick, true); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Ignoring you from now on, %sunignore me to undo", commandPrefix(config)), nil
+}
+
+// unignoreCommand handles ".unignore me", which undoes ".ignore me".
+func unignoreCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	if len(args) != 1 || !strings.EqualFold(args[0], "me") {
+		return "Usage: unignore me", nil
+	}
+	if err := optOuts.set(config, connections.name(conn), e.Nick, false); err != nil {
+		return "", err
+	}
+	return "Not ignoring you anymore", nil
+}
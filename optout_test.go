@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestOptOutStore(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	store := &optOutStore{}
+
+	for _, nick := range []string{"Alice", "bob"} {
+		if err := store.set(config, "libera", nick, true); err != nil {
+			t.Fatalf("set(%q) error = %v", nick, err)
+		}
+	}
+	if err := store.set(config, "libera", "BOB", false); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+	// Opting in without having opted out is fine
+	if err := store.set(config, "oftc", "carol", false); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+
+	// A fresh store reads the opt-outs back from disk
+	reloaded := &optOutStore{}
+	tests := []struct {
+		network string
+		nick    string
+		want    bool
+	}{
+		{network: "libera", nick: "alice", want: true},
+		{network: "libera", nick: "ALICE", want: true},
+		{network: "oftc", nick: "alice", want: false},
+		{network: "libera", nick: "bob", want: false},
+		{network: "oftc", nick: "carol", want: false},
+	}
+	for _, tt := range tests {
+		got, err := reloaded.has(config, tt.network, tt.nick)
+		if err != nil || got != tt.want {
+			t.Errorf("has(%q, %q) = %v, %v, want %v", tt.network, tt.nick, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsOptedOut(t *testing.T) {
+	previous := optOuts
+	optOuts = &optOutStore{}
+	t.Cleanup(func() { optOuts = previous })
+
+	conn := newNetworkConn(t)
+	config := &Config{DataDir: t.TempDir()}
+	if err := optOuts.set(config, "libera", "alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if !isOptedOut(config, conn, discardLogger, "Alice") {
+		t.Error("opted out user is not ignored")
+	}
+	if isOptedOut(config, conn, discardLogger, "bob") {
+		t.Error("user who didn't opt out is ignored")
+	}
+
+	// Users are replied to as usual when the opt-outs can't be read
+	broken := &Config{DataDir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(broken.DataDir, optOutsFile), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	optOuts = &optOutStore{}
+	if isOptedOut(broken, conn, discardLogger, "alice") {
+		t.Error("user is ignored when the opt-outs can't be read")
+	}
+}
+
+func TestIgnoreCommands(t *testing.T) {
+	previous := optOuts
+	optOuts = &optOutStore{}
+	t.Cleanup(func() { optOuts = previous })
+
+	conn := newNetworkConn(t)
+	config := &Config{DataDir: t.TempDir()}
+	e := &irc.Event{Code: "PRIVMSG", Nick: "alice", Arguments: []string{"#go", ".ignore me"}}
+
+	steps := []struct {
+		name    string
+		command func(*Config, *irc.Connection, *irc.Event, []string) (string, error)
+		args    []string
+		want    string
+		wantOut bool
+	}{
+		{name: "ignore without me", command: ignoreCommand, args: []string{"bob"}, want: "Usage: ignore me"},
+		{name: "ignore", command: ignoreCommand, args: []string{"ME"}, want: "Ignoring you from now on, .unignore me to undo", wantOut: true},
+		{name: "unignore without me", command: unignoreCommand, want: "Usage: unignore me", wantOut: true},
+		{name: "unignore", command: unignoreCommand, args: []string{"me"}, want: "Not ignoring you anymore"},
+	}
+	for _, step := range steps {
+		got, err := step.command(config, conn, e, step.args)
+		if err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: got %q, want %q", step.name, got, step.want)
+		}
+		if out := isOptedOut(config, conn, discardLogger, "alice"); out != step.wantOut {
+			t.Errorf("%s: opted out = %v, want %v", step.name, out, step.wantOut)
+		}
+	}
+
+	for command, want := range map[string]bool{"ignore": true, "UNIGNORE": true, "title": false} {
+		if got := isOptOutCommand(command); got != want {
+			t.Errorf("isOptOutCommand(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// overlayPath returns the overlay of the configuration file for an environment, e.g. config.prod.yaml
+// next to config.yaml for "prod". The -env flag takes precedence over GOBOTLITE_ENV, no environment means no overlay.
+func overlayPath(path, flagValue string) string {
+	env := flagValue
+	if env == "" {
+		env = os.Getenv("GOBOTLITE_ENV")
+	}
+	if env == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// mergeYAML merges overlay into base. Mappings are merged key by key, any other value in overlay replaces the one in base.
+func mergeYAML(base, overlay any) any {
+	baseMap, ok := base.(map[interface{}]interface{})
+	overlayMap, overlayOK := overlay.(map[interface{}]interface{})
+	if !ok || !overlayOK {
+		return overlay
+	}
+	for key, value := range overlayMap {
+		if existing, ok := baseMap[key]; ok {
+			value = mergeYAML(existing, value)
+		}
+		baseMap[key] = value
+	}
+	return baseMap
+}
+
+// applyOverlay returns the configuration data with the settings of the overlay data merged on top.
+func applyOverlay(data, overlay []byte) ([]byte, error) {
+	var base, top any
+	if err := yaml.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(overlay, &top); err != nil {
+		return nil, fmt.Errorf("error parsing overlay: %w", err)
+	}
+	// An empty overlay changes nothing
+	if top == nil {
+		return data, nil
+	}
+	return yaml.Marshal(mergeYAML(base, top))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestOverlayPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		flag string
+		env  string
+		want string
+	}{
+		{name: "no environment", path: "config.yaml", want: ""},
+		{name: "flag", path: "config.yaml", flag: "prod", want: "config.prod.yaml"},
+		{name: "environment variable", path: "/etc/gobot/config.yml", env: "dev", want: "/etc/gobot/config.dev.yml"},
+		{name: "flag wins", path: "config.yaml", flag: "prod", env: "dev", want: "config.prod.yaml"},
+		{name: "no extension", path: "config", flag: "prod", want: "config.prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOBOTLITE_ENV", tt.env)
+			if got := overlayPath(tt.path, tt.flag); got != tt.want {
+				t.Errorf("overlayPath(%q, %q) = %q, want %q", tt.path, tt.flag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOverlay(t *testing.T) {
+	base := `
+quitMessage: bye
+maxMessageLength: 300
+networks:
+  libera:
+    server: irc.libera.chat
+    port: 6697
+    channels: ["#go", "#rust"]
+  oftc:
+    server: irc.oftc.net
+`
+
+	tests := []struct {
+		name    string
+		overlay string
+		want    func(*Config)
+		wantErr bool
+	}{
+		{name: "empty overlay", overlay: "", want: func(c *Config) {}},
+		{name: "scalar replaces", overlay: "quitMessage: see you", want: func(c *Config) { c.QuitMessage = "see you" }},
+		{
+			name:    "mappings merge key by key",
+			overlay: "networks: {libera: {port: 6667}}",
+			want: func(c *Config) {
+				libera := c.Networks["libera"]
+				libera.Port = 6667
+				c.Networks["libera"] = libera
+			},
+		},
+		{
+			name:    "lists replace",
+			overlay: "networks: {libera: {channels: ['#test']}}",
+			want: func(c *Config) {
+				libera := c.Networks["libera"]
+				libera.Channels = []string{"#test"}
+				c.Networks["libera"] = libera
+			},
+		},
+		{
+			name:    "new keys are added",
+			overlay: "networks: {efnet: {server: irc.efnet.org}}",
+			want:    func(c *Config) { c.Networks["efnet"] = Network{Server: "irc.efnet.org"} },
+		},
+		{name: "invalid overlay", overlay: "networks: [", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := applyOverlay([]byte(base), []byte(tt.overlay))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyOverlay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got, want Config
+			if err := yaml.Unmarshal(data, &got); err != nil {
+				t.Fatalf("merged configuration doesn't parse: %v", err)
+			}
+			if err := yaml.Unmarshal([]byte(base), &want); err != nil {
+				t.Fatal(err)
+			}
+			tt.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("merged configuration = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
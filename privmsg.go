@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	registerFeature("privmsg", func(config *Config, conn *irc.Connection) {
+		logger := connections.logger(conn)
+		conn.AddCallback("PRIVMSG", func(e *irc.Event) {
+			handlePrivmsg(config, conn, logger, e)
+		})
+	})
+}
+
+// defaultMaxURLsPerMessage is how many URLs of a single message are looked up by default
+const defaultMaxURLsPerMessage = 2
+
+// defaultCommandPrefix starts commands unless another prefix is configured
+const defaultCommandPrefix = "."
+
+// commandPrefix returns the prefix that starts commands.
+func commandPrefix(config *Config) string {
+	if config.CommandPrefix == "" {
+		return defaultCommandPrefix
+	}
+	return config.CommandPrefix
+}
+
+// validateCommandPrefix checks that the command prefix is a single character that can't start a word or URL.
+func validateCommandPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	r, size := utf8.DecodeRuneInString(prefix)
+	if size != len(prefix) || r == utf8.RuneError {
+		return fmt.Errorf("commandPrefix must be a single character: %q", prefix)
+	}
+	if unicode.IsSpace(r) || unicode.IsControl(r) {
+		return fmt.Errorf("commandPrefix can't be whitespace or a control character: %q", prefix)
+	}
+	// Letters and digits would turn ordinary words and every "http" link into commands
+	if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return fmt.Errorf("commandPrefix can't be a letter or a digit: %q", prefix)
+	}
+	return nil
+}
+
+// defaultBridgePrefixes are used when no bridge prefixes are configured.
+// Matrix bridges prefix messages with * when linking to Discord and it's annoying AF
+var defaultBridgePrefixes = []string{"*"}
+
+// hasBridgePrefix reports whether a message starts with one of the configured bridge markers.
+func hasBridgePrefix(config *Config, message string) bool {
+	prefixes := config.BridgePrefixes
+	if prefixes == nil {
+		prefixes = defaultBridgePrefixes
+	}
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnoredNick reports whether messages from nick should be ignored, used for other bots.
+// Both the global and the network's ignore lists apply.
+func isIgnoredNick(config *Config, conn *irc.Connection, nick string) bool {
+	for _, pattern := range slices.Concat(config.IgnoredNicks, config.Networks[connections.name(conn)].IgnoredNicks) {
+		if nickMatches(pattern, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// nickMatches reports whether a nick matches an ignore list entry. Only exact nicks are supported
+// for now, entries with wildcards would be matched here.
+func nickMatches(pattern, nick string) bool {
+	return strings.EqualFold(pattern, nick)
+}
+
+// isPrivate reports whether the message was sent directly to the bot instead of a channel.
+func isPrivate(conn *irc.Connection, e *irc.Event) bool {
+	return strings.EqualFold(e.Arguments[0], botNick(conn))
+}
+
+// replyTarget returns where replies to a message should go, the sender for private messages.
+func replyTarget(conn *irc.Connection, e *irc.Event) string {
+	if isPrivate(conn, e) {
+		return e.Nick
+	}
+	return e.Arguments[0]
+}
+
+// defaultCommand returns the command configured to run on a channel when only the prefix is sent.
+func defaultCommand(config *Config, conn *irc.Connection, channel string) (string, bool) {
+	network := config.Networks[connections.name(conn)]
+	for name, command := range network.DefaultCommands {
+		if strings.EqualFold(normalizeChannel(conn, name), channel) && strings.TrimSpace(command) != "" {
+			return command, true
+		}
+	}
+	return "", false
+}
+
+// runCommand handles a command and logs the error if it fails, it's meant to be run as a goroutine.
+func runCommand(config *Config, conn *irc.Connection, logger *slog.Logger, e *irc.Event, commandStr string) {
+	err := handleCommand(config, conn, logger, e, commandStr)
+	switch {
+	case errors.Is(err, errAPITimeout):
+		logger.Warn("Command backend timed out", "command", commandStr, "error", err)
+	case err != nil:
+		logger.Error("Error handling command", "command", commandStr, "error", err)
+	}
+}
+
+// handlePrivmsg dispatches a channel or private message to the command or URL handlers.
+func handlePrivmsg(config *Config, conn *irc.Connection, logger *slog.Logger, e *irc.Event) {
+	var channel = e.Arguments[0]
+	// Our own messages are only seen with echo-message and are never commands
+	if isEcho(conn, e) {
+		return
+	}
+	messageStats.received(conn, channel)
+
+	// Ignore other bots
+	if isIgnoredNick(config, conn, e.Nick) {
+		return
+	}
+
+	// logger.Debug("PRIVMSG", "message", e.Message())
+
+	// Don't act on anything before the bot has settled in after connecting
+	if inStartupGrace(config, conn) {
+		logger.Debug("Ignoring message during startup grace period", "channel", channel, "nick", e.Nick)
+		return
+	}
+
+	words := strings.Fields(e.Message())
+
+	// nothing to process
+	if len(words) == 0 {
+		return
+	}
+
+	bridged := hasBridgePrefix(config, e.Message())
+
+	if command, ok := messageCommand(config, conn, e, bridged); ok {
+		if command != "" {
+			go runCommand(config, conn, logger, e, command)
+		}
+		return
+	}
+
+	// Titles are disabled without an endpoint
+	if config.TitleBackend.Endpoint == "" {
+		return
+	}
+
+	if isOptedOut(config, conn, logger, e.Nick) {
+		return
+	}
+
+	if urls := messageURLs(config, logger, channel, words, bridged); len(urls) > 0 {
+		go handleURLs(config, conn, logger, e, urls)
+	}
+}
+
+// messageCommand returns the command a message runs, and whether the message is a command at all.
+// The command is empty when there's nothing to run, e.g. for a bare prefix on a channel without a default command.
+func messageCommand(config *Config, conn *irc.Connection, e *irc.Event, bridged bool) (string, bool) {
+	if bridged {
+		return "", false
+	}
+	message := e.Message()
+
+	// A bare prefix runs the default command of the channel, if it has one
+	prefix := commandPrefix(config)
+	if message == prefix {
+		command, _ := defaultCommand(config, conn, e.Arguments[0])
+		return command, true
+	}
+
+	// handle commands, command needs to be at least one character past prefix
+	if strings.HasPrefix(message, prefix) && len(message) > len(prefix) {
+		return message[len(prefix):], true
+	}
+
+	// In private there's no doubt who the message is for, so admins can leave out the prefix
+	words := strings.Fields(message)
+	if config.BarePrivateCommands && isPrivate(conn, e) && isAdmin(config, e.Source) && len(words) > 0 && !strings.HasPrefix(words[0], "http") {
+		return message, true
+	}
+	return "", false
+}
+
+// messageURLs returns the URLs to look up titles for in the words of a message, without duplicates,
+// credentials or the ones over the per-message limit. URLs relayed by bridges are ignored.
+func messageURLs(config *Config, logger *slog.Logger, channel string, words []string, bridged bool) []string {
+	maxURLs := config.TitleBackend.MaxURLsPerMessage
+	if maxURLs <= 0 {
+		maxURLs = defaultMaxURLsPerMessage
+	}
+
+	var urls []string
+	for _, word := range words {
+		if !strings.HasPrefix(word, "http") {
+			continue
+		}
+
+		u, err := url.Parse(word)
+
+		if err != nil {
+			logger.Warn("Error parsing potential URL", "word", word, "error", err)
+		} else if u.Scheme != "" && u.Host != "" {
+			// never log or forward credentials embedded in the URL
+			urlStr := stripUserinfo(u)
+
+			// ignore messages relayed by bridges
+			if bridged {
+				logger.Info("Ignoring URL", "url", urlStr)
+
+			} else {
+				// Valid URL detected, handle accordingly
+				logger.Info("URL detected", "channel", channel, "url", urlStr)
+				if !slices.Contains(urls, urlStr) {
+					urls = append(urls, urlStr)
+				}
+			}
+		}
+	}
+
+	if len(urls) > maxURLs {
+		logger.Info("Too many URLs in one message, ignoring the rest", "channel", channel, "ignored", len(urls)-maxURLs)
+		urls = urls[:maxURLs]
+	}
+	return urls
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func init() {
+	registerFeature("relay", func(config *Config, conn *irc.Connection) {
+		if len(config.Relays) == 0 {
+			return
+		}
+		conn.AddCallback("PRIVMSG", func(e *irc.Event) {
+			handleRelay(config, conn, e, fmt.Sprintf("<%s> %s", e.Nick, e.Message()))
+		})
+		conn.AddCallback("CTCP_ACTION", func(e *irc.Event) {
+			handleRelay(config, conn, e, fmt.Sprintf("* %s %s", e.Nick, e.Message()))
+		})
+	})
+}
+
+// validateRelays checks that every relay refers to configured networks and doesn't relay a channel to itself.
+func validateRelays(c *Config) error {
+	for i, relay := range c.Relays {
+		for _, end := range []RelayEndpoint{relay.From, relay.To} {
+			if _, ok := c.Networks[end.Network]; !ok {
+				return fmt.Errorf("relay %d refers to unknown network: %s", i+1, end.Network)
+			}
+			if end.Channel == "" {
+				return fmt.Errorf("relay %d is missing a channel", i+1)
+			}
+		}
+		if relay.From.Network == relay.To.Network &&
+			strings.EqualFold(normalizeChannel(nil, relay.From.Channel), normalizeChannel(nil, relay.To.Channel)) {
+			return fmt.Errorf("relay %d relays %s to itself", i+1, relay.From.Channel)
+		}
+	}
+	return nil
+}
+
+// handleRelay forwards a channel message to every relay target configured for its origin.
+func handleRelay(config *Config, conn *irc.Connection, e *irc.Event, line string) {
+	if len(e.Arguments) == 0 {
+		return
+	}
+	channel := e.Arguments[0]
+
+	// Never relay the bot itself or ignored bots
+	if isEcho(conn, e) || isIgnoredNick(config, conn, e.Nick) {
+		return
+	}
+
+	network := connections.name(conn)
+	for _, relay := range config.Relays {
+		if relay.From.Network != network || !strings.EqualFold(normalizeChannel(conn, relay.From.Channel), channel) {
+			continue
+		}
+
+		target, ok := connections.get(relay.To.Network)
+		if !ok {
+			slog.Warn("Relay target network is not connected", "network", relay.To.Network)
+			continue
+		}
+		if isRelaySource(relay, target, e) {
+			continue
+		}
+		// A flood on the origin channel is rate limited like replies instead of being passed on in full
+		sendReply(config, target, normalizeChannel(target, relay.To.Channel), fmt.Sprintf("[%s] %s", network, line))
+	}
+}
+
+// isRelaySource reports whether a message was sent by a relay into the origin channel: the bot itself
+// on the target connection, which is the case when both ends are on the same server, or a relay peer.
+func isRelaySource(relay RelayConfig, target *irc.Connection, e *irc.Event) bool {
+	return isEcho(target, e) || slices.ContainsFunc(relay.Peers, func(peer string) bool {
+		return nickMatches(peer, e.Nick)
+	})
+}
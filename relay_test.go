@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"slices"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestValidateRelays(t *testing.T) {
+	networks := map[string]Network{"libera": {}, "oftc": {}}
+
+	tests := []struct {
+		name    string
+		relay   RelayConfig
+		wantErr bool
+	}{
+		{
+			name:  "between networks",
+			relay: RelayConfig{From: RelayEndpoint{Network: "libera", Channel: "#go"}, To: RelayEndpoint{Network: "oftc", Channel: "#go"}},
+		},
+		{
+			name:  "between channels",
+			relay: RelayConfig{From: RelayEndpoint{Network: "libera", Channel: "#go"}, To: RelayEndpoint{Network: "libera", Channel: "#golang"}},
+		},
+		{
+			name:    "unknown network",
+			relay:   RelayConfig{From: RelayEndpoint{Network: "libera", Channel: "#go"}, To: RelayEndpoint{Network: "efnet", Channel: "#go"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing channel",
+			relay:   RelayConfig{From: RelayEndpoint{Network: "libera", Channel: "#go"}, To: RelayEndpoint{Network: "oftc"}},
+			wantErr: true,
+		},
+		{
+			name:    "to itself",
+			relay:   RelayConfig{From: RelayEndpoint{Network: "libera", Channel: "go"}, To: RelayEndpoint{Network: "libera", Channel: "#GO"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRelays(&Config{Networks: networks, Relays: []RelayConfig{tt.relay}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRelays() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleRelay(t *testing.T) {
+	target, lines := newServerConn(t)
+	origin := irc.IRC("relaybot", "relaybot")
+	origin.Log = log.New(io.Discard, "", 0)
+	connections.add("oftc", origin, slog.Default())
+	t.Cleanup(func() { connections.remove(origin) })
+
+	config := &Config{
+		IgnoredNicks: []string{"otherbot"},
+		Relays: []RelayConfig{{
+			From:  RelayEndpoint{Network: "oftc", Channel: "go"},
+			To:    RelayEndpoint{Network: "libera", Channel: "#gophers"},
+			Peers: []string{"bridge"},
+		}},
+	}
+	for _, f := range features {
+		if f.name == "relay" {
+			f.setup(config, origin)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		nick    string
+		channel string
+		message string
+		want    []string
+	}{
+		{name: "message", nick: "alice", channel: "#go", message: "hello", want: []string{"PRIVMSG #gophers :[oftc] <alice> hello"}},
+		{name: "action", nick: "alice", channel: "#GO", message: "\x01ACTION waves\x01", want: []string{"PRIVMSG #gophers :[oftc] * alice waves"}},
+		// Only the source decides whether a line came through a relay
+		{name: "looks relayed", nick: "alice", channel: "#go", message: "[efnet] <bob> hi", want: []string{"PRIVMSG #gophers :[oftc] <alice> [efnet] <bob> hi"}},
+		{name: "other channel", nick: "alice", channel: "#rust", message: "hello"},
+		{name: "the bot itself", nick: "relaybot", channel: "#go", message: "hello"},
+		{name: "the bot on the target", nick: "gobot", channel: "#go", message: "[libera] <bob> hi"},
+		{name: "relay peer", nick: "Bridge", channel: "#go", message: "[efnet] <bob> hi"},
+		{name: "ignored nick", nick: "otherbot", channel: "#go", message: "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin.RunCallbacks(&irc.Event{
+				Code:      "PRIVMSG",
+				Nick:      tt.nick,
+				Source:    tt.nick + "!user@example.com",
+				Arguments: []string{tt.channel, tt.message},
+			})
+			if got := sentLines(t, target, lines); !slices.Equal(got, tt.want) {
+				t.Errorf("relayed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
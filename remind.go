@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+const (
+	remindersFile = "reminders.json"
+	// how often due reminders are checked
+	reminderInterval = 15 * time.Second
+)
+
+// reminderTimeLayouts are the accepted absolute times, in local time
+var reminderTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", "15:04"}
+
+// Reminder is a message scheduled to be sent to a channel.
+type Reminder struct {
+	Network string    `json:"network"`
+	Channel string    `json:"channel"`
+	At      time.Time `json:"at"`
+	Message string    `json:"message"`
+	SetBy   string    `json:"setBy"`
+}
+
+// reminderStore holds the pending reminders, persisted to disk.
+type reminderStore struct {
+	sync.Mutex
+	clock     Clock
+	loaded    bool
+	reminders []Reminder
+	start     sync.Once
+}
+
+var reminders = &reminderStore{clock: defaultClock}
+
+func init() {
+	registerFeature("remind", func(config *Config, conn *irc.Connection) {
+		reminders.start.Do(func() {
+			go reminders.run(config)
+		})
+	})
+	registerAdminCommand("remindall", remindAllCommand)
+}
+
+// load reads the persisted reminders on first use. The caller must hold the lock.
+func (s *reminderStore) load(config *Config) error {
+	if s.loaded {
+		return nil
+	}
+	if err := loadJSON(config, remindersFile, &s.reminders); err != nil {
+		return err
+	}
+	s.loaded = true
+	return nil
+}
+
+// add schedules a reminder and persists it.
+func (s *reminderStore) add(config *Config, reminder Reminder) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return err
+	}
+	s.reminders = append(s.reminders, reminder)
+	return saveJSON(config, remindersFile, s.reminders)
+}
+
+// due removes and returns the reminders whose time has come on networks that can deliver them.
+// Reminders for a network that can't be reached right now stay pending until it can.
+func (s *reminderStore) due(config *Config, now time.Time, deliverable func(network string) bool) ([]Reminder, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(config); err != nil {
+		return nil, err
+	}
+	var due, pending []Reminder
+	ready := map[string]bool{}
+	for _, reminder := range s.reminders {
+		if reminder.At.After(now) {
+			pending = append(pending, reminder)
+			continue
+		}
+		if _, checked := ready[reminder.Network]; !checked {
+			ready[reminder.Network] = deliverable(reminder.Network)
+			if !ready[reminder.Network] {
+				slog.Debug("Network is not connected, keeping reminders", "network", reminder.Network)
+			}
+		}
+		if ready[reminder.Network] {
+			due = append(due, reminder)
+		} else {
+			pending = append(pending, reminder)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	s.reminders = pending
+	return due, saveJSON(config, remindersFile, s.reminders)
+}
+
+// run sends due reminders until the process exits.
+func (s *reminderStore) run(config *Config) {
+	for {
+		now := <-s.clock.After(reminderInterval)
+		due, err := s.due(config, now, func(network string) bool {
+			return reminderDeliverable(config, network)
+		})
+		if err != nil {
+			slog.Error("Error checking reminders", "error", err)
+		}
+		// The same reminder set on several channels goes out as one message where the server allows it
+		type announcement struct{ network, message string }
+		var order []announcement
+		channels := map[announcement][]string{}
+		for _, reminder := range due {
+			a := announcement{reminder.Network, reminder.Message}
+			if _, ok := channels[a]; !ok {
+				order = append(order, a)
+			}
+			if !slices.Contains(channels[a], reminder.Channel) {
+				channels[a] = append(channels[a], reminder.Channel)
+			}
+		}
+		for _, a := range order {
+			conn, ok := connections.get(a.network)
+			if !ok {
+				slog.Warn("Dropping reminder for unknown network", "network", a.network)
+				continue
+			}
+			sendMessageToAll(conn, channels[a], "Reminder: "+a.message)
+		}
+	}
+}
+
+// reminderDeliverable reports whether reminders can be sent to a network now, i.e. the bot has registered on it.
+// Networks that are no longer configured are let through so their reminders are dropped instead of kept forever.
+func reminderDeliverable(config *Config, network string) bool {
+	if _, ok := config.Networks[network]; !ok {
+		return true
+	}
+	conn, ok := connections.get(network)
+	return ok && conn.Connected() && !connectedAt.get(conn).IsZero()
+}
+
+// parseReminderTime parses a relative duration like "90m" or an absolute local time like "2006-01-02 15:04" or "15:04".
+// A time of day that has already passed today means tomorrow.
+func parseReminderTime(when string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(when); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("duration must be positive")
+		}
+		return now.Add(d), nil
+	}
+
+	for _, layout := range reminderTimeLayouts {
+		t, err := time.ParseInLocation(layout, when, now.Location())
+		if err != nil {
+			continue
+		}
+		if layout == "15:04" {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("time is in the past")
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unknown time format %q", when)
+}
+
+// remindAllCommand handles ".remindall [#channel] <when> <message>".
+func remindAllCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	isChannel := func(target string) bool {
+		return target != "" && strings.ContainsRune(chanTypes(conn), rune(target[0]))
+	}
+	channel := e.Arguments[0]
+	if len(args) > 0 && isChannel(args[0]) {
+		channel, args = args[0], args[1:]
+	}
+	if len(args) < 2 {
+		return "Usage: remindall [#channel] <30m|15:04|2006-01-02T15:04> <message>", nil
+	}
+	if !isChannel(channel) {
+		return "Reminders need a channel", nil
+	}
+
+	// Absolute times can be given with a space between date and time
+	when, message := args[0], args[1:]
+	if len(args) > 2 {
+		if _, err := time.Parse("2006-01-02 15:04", args[0]+" "+args[1]); err == nil {
+			when, message = args[0]+" "+args[1], args[2:]
+		}
+	}
+
+	at, err := parseReminderTime(when, reminders.clock.Now())
+	if err != nil {
+		return fmt.Sprintf("Invalid time: %s", err), nil
+	}
+
+	reminder := Reminder{
+		Network: connections.name(conn),
+		Channel: channel,
+		At:      at,
+		Message: strings.Join(message, " "),
+		SetBy:   e.Nick,
+	}
+	if err := reminders.add(config, reminder); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Reminder for %s set at %s", channel, at.Format("2006-01-02 15:04")), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestReminderStoreDue(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	store := &reminderStore{clock: defaultClock}
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	for _, reminder := range []Reminder{
+		{Network: "libera", Channel: "#go", At: now.Add(-time.Minute), Message: "due"},
+		{Network: "libera", Channel: "#go", At: now.Add(time.Minute), Message: "later"},
+		{Network: "oftc", Channel: "#go", At: now.Add(-time.Minute), Message: "offline"},
+	} {
+		if err := store.add(config, reminder); err != nil {
+			t.Fatalf("add() error = %v", err)
+		}
+	}
+
+	connected := map[string]bool{"libera": true}
+	deliverable := func(network string) bool { return connected[network] }
+
+	due, err := store.due(config, now, deliverable)
+	if err != nil {
+		t.Fatalf("due() error = %v", err)
+	}
+	if len(due) != 1 || due[0].Message != "due" {
+		t.Errorf("due() = %v, want the libera reminder", due)
+	}
+
+	// The reminder of the disconnected network goes out once it's back
+	connected["oftc"] = true
+	due, err = (&reminderStore{clock: defaultClock}).due(config, now.Add(2*time.Minute), deliverable)
+	if err != nil {
+		t.Fatalf("due() error = %v", err)
+	}
+	var messages []string
+	for _, reminder := range due {
+		messages = append(messages, reminder.Message)
+	}
+	if len(messages) != 2 || messages[0] != "later" || messages[1] != "offline" {
+		t.Errorf("due() after reconnecting = %v, want [later offline]", messages)
+	}
+}
+
+func TestReminderDeliverable(t *testing.T) {
+	config := &Config{Networks: map[string]Network{"libera": {}}}
+
+	if reminderDeliverable(config, "libera") {
+		t.Error("reminderDeliverable() without a connection = true, want false")
+	}
+	if !reminderDeliverable(config, "removed") {
+		t.Error("reminderDeliverable() for an unconfigured network = false, want true")
+	}
+}
+
+func TestParseReminderTime(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		when    string
+		want    time.Time
+		wantErr bool
+	}{
+		{when: "90m", want: now.Add(90 * time.Minute)},
+		{when: "15:04", want: time.Date(2026, 10, 14, 15, 4, 0, 0, time.UTC)},
+		{when: "11:00", want: time.Date(2026, 10, 15, 11, 0, 0, 0, time.UTC)},
+		{when: "2026-10-20T08:30", want: time.Date(2026, 10, 20, 8, 30, 0, 0, time.UTC)},
+		{when: "2026-10-20 08:30", want: time.Date(2026, 10, 20, 8, 30, 0, 0, time.UTC)},
+		{when: "2026-10-01 08:30", wantErr: true},
+		{when: "-5m", wantErr: true},
+		{when: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.when, func(t *testing.T) {
+			got, err := parseReminderTime(tt.when, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReminderTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseReminderTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemindAllWithFakeClock(t *testing.T) {
+	clock := &manualClock{now: time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)}
+	previous := reminders
+	reminders = &reminderStore{clock: clock}
+	t.Cleanup(func() { reminders = previous })
+
+	config := &Config{DataDir: t.TempDir()}
+	conn := newNetworkConn(t)
+	e := &irc.Event{Code: "PRIVMSG", Nick: "owner", Arguments: []string{"#go", ".remindall"}}
+
+	reply, err := remindAllCommand(config, conn, e, []string{"30m", "stand", "up"})
+	if err != nil {
+		t.Fatalf("remindAllCommand() error = %v", err)
+	}
+	if want := "Reminder for #go set at 2026-10-14 12:30"; reply != want {
+		t.Errorf("remindAllCommand() = %q, want %q", reply, want)
+	}
+
+	always := func(network string) bool { return true }
+	now := <-clock.After(29 * time.Minute)
+	if due, err := reminders.due(config, now, always); err != nil || len(due) != 0 {
+		t.Errorf("due() a minute early = %v, %v, want none", due, err)
+	}
+
+	now = <-clock.After(time.Minute)
+	due, err := reminders.due(config, now, always)
+	if err != nil {
+		t.Fatalf("due() error = %v", err)
+	}
+	if len(due) != 1 || due[0].Message != "stand up" || due[0].Network != "libera" || due[0].SetBy != "owner" {
+		t.Errorf("due() = %+v, want the stand up reminder", due)
+	}
+}
+
+func TestRemindAllChannelTypes(t *testing.T) {
+	previous := reminders
+	reminders = &reminderStore{clock: &manualClock{now: time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)}}
+	t.Cleanup(func() { reminders = previous })
+
+	conn := newISupportConn(t, "CHANTYPES=#&")
+	connections.add("libera", conn, discardLogger)
+	t.Cleanup(func() { connections.remove(conn) })
+	config := &Config{DataDir: t.TempDir()}
+
+	tests := []struct {
+		name   string
+		target string
+		args   []string
+		want   string
+	}{
+		{name: "in a local channel", target: "&ops", args: []string{"30m", "stand", "up"}, want: "Reminder for &ops set at 2026-10-14 12:30"},
+		{name: "for a local channel", target: "gobot", args: []string{"&ops", "30m", "stand", "up"}, want: "Reminder for &ops set at 2026-10-14 12:30"},
+		{name: "for an unsupported type", target: "gobot", args: []string{"!ops", "30m", "stand", "up"}, want: "Reminders need a channel"},
+		{name: "in private", target: "gobot", args: []string{"30m", "stand", "up"}, want: "Reminders need a channel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &irc.Event{Code: "PRIVMSG", Nick: "owner", Arguments: []string{tt.target, ".remindall"}}
+			reply, err := remindAllCommand(config, conn, e, tt.args)
+			if err != nil || reply != tt.want {
+				t.Errorf("remindAllCommand() = %q, %v, want %q", reply, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	irc "github.com/thoj/go-ircevent"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultLineLength is the IRC line limit including the trailing CRLF, from RFC 1459
+	defaultLineLength = 512
+	// maxHostLength is the longest hostname the server can put in our prefix when relaying a message
+	maxHostLength = 63
+	// pacedMessageDelay is the time between the lines of long output sent with sendPaced
+	pacedMessageDelay = time.Second
+)
+
+// maxMessageLengths holds the configured message length limit of each connection's network
+var (
+	maxMessageLengthsMutex sync.Mutex
+	maxMessageLengths      = map[*irc.Connection]int{}
+)
+
+func init() {
+	registerFeature("sender", func(config *Config, conn *irc.Connection) {
+		maxMessageLengthsMutex.Lock()
+		defer maxMessageLengthsMutex.Unlock()
+		maxMessageLengths[conn] = config.MaxMessageLength
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		maxMessageLengthsMutex.Lock()
+		delete(maxMessageLengths, conn)
+		maxMessageLengthsMutex.Unlock()
+
+		replyLimitersMutex.Lock()
+		delete(replyLimiters, conn)
+		replyLimitersMutex.Unlock()
+	})
+}
+
+// maxMessageBytes returns how many bytes of message text fit in one PRIVMSG or NOTICE to target,
+// or the configured maximum message length if that's shorter.
+// The server prefixes relayed messages with ":nick!user@host ", which counts against the line limit too.
+func maxMessageBytes(conn *irc.Connection, target string) int {
+	lineLength := isupportInt(conn, "LINELEN")
+	if lineLength <= 0 {
+		lineLength = defaultLineLength
+	}
+
+	// The IRC library uses the nick as the user name as well, NOTICE is one letter shorter than PRIVMSG
+	nick := botNick(conn)
+	prefix := len(":!@ ") + len(nick)*2 + maxHostLength
+	command := len("PRIVMSG  :\r\n") + len(target)
+	limit := max(lineLength-prefix-command, 1)
+
+	maxMessageLengthsMutex.Lock()
+	configured := maxMessageLengths[conn]
+	maxMessageLengthsMutex.Unlock()
+	if configured > 0 {
+		limit = min(limit, configured)
+	}
+	return limit
+}
+
+// truncateMessage cuts a message to what fits on one line to target without breaking UTF-8 characters,
+// for messages that shouldn't be split over several lines.
+func truncateMessage(conn *irc.Connection, target, message string) string {
+	return splitMessage(message, maxMessageBytes(conn, target))[0]
+}
+
+// splitMessage splits a message into chunks of at most limit bytes without breaking UTF-8 characters.
+func splitMessage(message string, limit int) []string {
+	var chunks []string
+	for len(message) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			// A single character longer than the limit, send it as is
+			_, cut = utf8.DecodeRuneInString(message)
+		}
+		// Break at the last space instead, unless that would leave a short line
+		if space := strings.LastIndexByte(message[:min(cut+1, len(message))], ' '); space >= cut/2 {
+			chunks = append(chunks, message[:space])
+			message = message[space+1:]
+			continue
+		}
+		chunks = append(chunks, message[:cut])
+		message = message[cut:]
+	}
+	// Nothing is left when the last line ended at a space
+	if message == "" && len(chunks) > 0 {
+		return chunks
+	}
+	return append(chunks, message)
+}
+
+// ellipsis marks a reply that was cut short
+const ellipsis = "…"
+
+// defaultMaxContinuationLines is how many lines a reply may continue on by default
+const defaultMaxContinuationLines = 3
+
+// limitLines keeps the first maxLines chunks, ending the last one with an ellipsis if any were dropped.
+func limitLines(chunks []string, maxLines, limit int) []string {
+	if len(chunks) <= maxLines {
+		return chunks
+	}
+	chunks = chunks[:maxLines]
+	last := chunks[maxLines-1]
+	if len(last)+len(ellipsis) > limit {
+		last = splitMessage(last, max(limit-len(ellipsis), 1))[0]
+	}
+	chunks[maxLines-1] = last + ellipsis
+	return chunks
+}
+
+// sendMessage sends a PRIVMSG, split over several lines if it doesn't fit on one.
+// The message is sanitized first, like in every send helper, so text from users, web pages and backends can't inject commands.
+func sendMessage(conn *irc.Connection, target, message string) {
+	message = sanitizeMessage(message)
+	if message == "" {
+		return
+	}
+	sendChunks(conn, target, splitMessage(message, maxMessageBytes(conn, target)))
+}
+
+// sendPaced sends each message with sendMessage, waiting delay between them so long output doesn't flood the server.
+func sendPaced(conn *irc.Connection, target string, messages []string, delay time.Duration) {
+	for i, message := range messages {
+		if i > 0 {
+			<-defaultClock.After(delay)
+		}
+		sendMessage(conn, target, message)
+	}
+}
+
+// sendChunks sends each chunk as its own PRIVMSG.
+func sendChunks(conn *irc.Connection, target string, chunks []string) {
+	for _, chunk := range chunks {
+		conn.Privmsg(target, chunk)
+	}
+	messageStats.sent(conn, target, len(chunks))
+}
+
+// sendNotice sends a NOTICE, split over several lines if it doesn't fit on one.
+func sendNotice(conn *irc.Connection, target, message string) {
+	message = sanitizeMessage(message)
+	if message == "" {
+		return
+	}
+	for _, chunk := range splitMessage(message, maxMessageBytes(conn, target)) {
+		conn.Notice(target, chunk)
+	}
+}
+
+// batchTargets groups targets into batches of at most limit targets, a limit of 0 puts them all in one batch.
+func batchTargets(targets []string, limit int) [][]string {
+	if limit <= 0 {
+		limit = len(targets)
+	}
+	var batches [][]string
+	for len(targets) > limit {
+		batches = append(batches, targets[:limit])
+		targets = targets[limit:]
+	}
+	if len(targets) > 0 {
+		batches = append(batches, targets)
+	}
+	return batches
+}
+
+// sendMessageToAll sends the same PRIVMSG to several targets, using comma-separated targets
+// as far as the server's TARGMAX allows and one PRIVMSG per target otherwise.
+func sendMessageToAll(conn *irc.Connection, targets []string, message string) {
+	message = sanitizeMessage(message)
+	if message == "" {
+		return
+	}
+	for _, batch := range batchTargets(targets, targMax(conn, "PRIVMSG")) {
+		target := strings.Join(batch, ",")
+		chunks := splitMessage(message, maxMessageBytes(conn, target))
+		for _, chunk := range chunks {
+			conn.Privmsg(target, chunk)
+		}
+		for _, t := range batch {
+			messageStats.sent(conn, t, len(chunks))
+		}
+	}
+}
+
+// replyLimiters holds the rate limiters of the replies of each connection, keyed by target
+// so that one busy channel doesn't use up the replies of the others.
+var (
+	replyLimitersMutex sync.Mutex
+	replyLimiters      = map[*irc.Connection]map[string]*rate.Limiter{}
+)
+
+// allowReply reports whether a reply to target is within the configured rate limit.
+func allowReply(config *Config, conn *irc.Connection, target string) bool {
+	limit := config.Security.RateLimit
+	if !limit.Enabled {
+		return true
+	}
+
+	now := defaultClock.Now()
+	key := strings.ToLower(target)
+	replyLimitersMutex.Lock()
+	limiters, ok := replyLimiters[conn]
+	if !ok {
+		limiters = map[string]*rate.Limiter{}
+		replyLimiters[conn] = limiters
+	}
+	// A limiter that has filled up again allows the same as a new one, drop those of quiet targets
+	for t, limiter := range limiters {
+		if t != key && limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(limiters, t)
+		}
+	}
+	limiter, ok := limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		limiters[key] = limiter
+	}
+	replyLimitersMutex.Unlock()
+
+	return limiter.AllowN(now, 1)
+}
+
+// sendReply sends a command or title reply, dropping it if the target has gone over the rate limit.
+// Long replies continue on up to MaxContinuationLines more lines, the rest is cut off.
+func sendReply(config *Config, conn *irc.Connection, target, message string) {
+	if !allowReply(config, conn, target) {
+		slog.Debug("Rate limited, dropping reply", "target", target, "message", message)
+		return
+	}
+
+	continuations := config.MaxContinuationLines
+	if continuations == 0 {
+		continuations = defaultMaxContinuationLines
+	}
+	message = sanitizeMessage(message)
+	if message == "" {
+		return
+	}
+	limit := maxMessageBytes(conn, target)
+	sendChunks(conn, target, limitLines(splitMessage(message, limit), 1+max(continuations, 0), limit))
+}
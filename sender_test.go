@@ -0,0 +1,268 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		limit   int
+		want    []string
+	}{
+		{name: "empty", message: "", limit: 10, want: []string{""}},
+		{name: "fits", message: "hello", limit: 10, want: []string{"hello"}},
+		{name: "exactly the limit", message: "0123456789", limit: 10, want: []string{"0123456789"}},
+		{name: "breaks at a space", message: "hello world again", limit: 11, want: []string{"hello world", "again"}},
+		{name: "space right after the limit", message: "hello world", limit: 5, want: []string{"hello", "world"}},
+		{name: "no spaces", message: "0123456789abc", limit: 5, want: []string{"01234", "56789", "abc"}},
+		{name: "short line at a space is avoided", message: "a bcdefghijkl", limit: 6, want: []string{"a bcde", "fghijk", "l"}},
+		{name: "multibyte characters are kept whole", message: "ääääää", limit: 5, want: []string{"ää", "ää", "ää"}},
+		{name: "character longer than the limit", message: "€€", limit: 2, want: []string{"€", "€"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.message, tt.limit)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitMessage(%q, %d) = %q, want %q", tt.message, tt.limit, got, tt.want)
+			}
+			for _, chunk := range got {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %q is not valid UTF-8", chunk)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxMessageBytes(t *testing.T) {
+	// ":gobot!gobot@<63 byte host> " and "PRIVMSG #go :\r\n" take 92 bytes
+	const overhead = 92
+
+	tests := []struct {
+		name   string
+		tokens []string
+		nick   string
+		target string
+		want   int
+	}{
+		{name: "default line length", target: "#go", want: defaultLineLength - overhead},
+		{name: "advertised line length", tokens: []string{"LINELEN=1024"}, target: "#go", want: 1024 - overhead},
+		{name: "invalid line length", tokens: []string{"LINELEN=long"}, target: "#go", want: defaultLineLength - overhead},
+		{name: "longer target", target: "#gophers", want: defaultLineLength - overhead - len("phers")},
+		{name: "longer nick", nick: "gobot_", target: "#go", want: defaultLineLength - overhead - 2},
+		{name: "tiny line length", tokens: []string{"LINELEN=10"}, target: "#go", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newISupportConn(t, tt.tokens...)
+			if tt.nick != "" {
+				currentNicks.set(conn, tt.nick)
+				t.Cleanup(func() { currentNicks.remove(conn) })
+			}
+			if got := maxMessageBytes(conn, tt.target); got != tt.want {
+				t.Errorf("maxMessageBytes(%q) = %d, want %d", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessageFitsTheLine(t *testing.T) {
+	conn := newISupportConn(t, "LINELEN=200")
+	limit := maxMessageBytes(conn, "#go")
+	for _, chunk := range splitMessage(strings.Repeat("word ", 100), limit) {
+		if len(chunk) > limit {
+			t.Errorf("chunk of %d bytes is longer than the limit of %d", len(chunk), limit)
+		}
+	}
+}
+
+func TestBatchTargets(t *testing.T) {
+	targets := []string{"#a", "#b", "#c", "#d", "#e"}
+
+	tests := []struct {
+		name    string
+		targets []string
+		limit   int
+		want    [][]string
+	}{
+		{name: "none", targets: nil, limit: 4, want: nil},
+		{name: "one at a time", targets: targets[:3], limit: 1, want: [][]string{{"#a"}, {"#b"}, {"#c"}}},
+		{name: "uneven", targets: targets, limit: 2, want: [][]string{{"#a", "#b"}, {"#c", "#d"}, {"#e"}}},
+		{name: "exactly the limit", targets: targets[:4], limit: 4, want: [][]string{{"#a", "#b", "#c", "#d"}}},
+		{name: "no limit", targets: targets, limit: 0, want: [][]string{targets}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := batchTargets(tt.targets, tt.limit)
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("batchTargets(%q, %d) = %q, want %q", tt.targets, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfiguredMaxMessageLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured int
+		want       int
+	}{
+		{name: "unset", configured: 0, want: defaultLineLength - 92},
+		{name: "shorter than the line", configured: 100, want: 100},
+		{name: "longer than the line", configured: 1000, want: defaultLineLength - 92},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newISupportConn(t)
+			for _, f := range features {
+				if f.name == "sender" {
+					f.setup(&Config{MaxMessageLength: tt.configured}, conn)
+				}
+			}
+			t.Cleanup(func() {
+				maxMessageLengthsMutex.Lock()
+				defer maxMessageLengthsMutex.Unlock()
+				delete(maxMessageLengths, conn)
+			})
+			if got := maxMessageBytes(conn, "#go"); got != tt.want {
+				t.Errorf("maxMessageBytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	conn := newISupportConn(t)
+	maxMessageLengthsMutex.Lock()
+	maxMessageLengths[conn] = 5
+	maxMessageLengthsMutex.Unlock()
+	t.Cleanup(func() {
+		maxMessageLengthsMutex.Lock()
+		defer maxMessageLengthsMutex.Unlock()
+		delete(maxMessageLengths, conn)
+	})
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{message: "", want: ""},
+		{message: "fits", want: "fits"},
+		{message: "hello world", want: "hello"},
+		{message: "äää", want: "ää"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := truncateMessage(conn, "#go", tt.message); got != tt.want {
+				t.Errorf("truncateMessage(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		maxLines int
+		limit    int
+		want     []string
+	}{
+		{name: "fits", chunks: []string{"one", "two"}, maxLines: 2, limit: 10, want: []string{"one", "two"}},
+		{name: "dropped lines", chunks: []string{"one", "two", "three"}, maxLines: 2, limit: 10, want: []string{"one", "two…"}},
+		{name: "single line", chunks: []string{"one", "two"}, maxLines: 1, limit: 10, want: []string{"one…"}},
+		// The last line is cut to make room for the ellipsis
+		{name: "full last line", chunks: []string{"hello world", "again"}, maxLines: 1, limit: 11, want: []string{"hello…"}},
+		{name: "multibyte last line", chunks: []string{"ääää", "ä"}, maxLines: 1, limit: 8, want: []string{"ää…"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := limitLines(tt.chunks, tt.maxLines, tt.limit)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("limitLines() = %q, want %q", got, tt.want)
+			}
+			for _, line := range got {
+				if len(line) > tt.limit {
+					t.Errorf("line %q is longer than %d bytes", line, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestSendHelpersSanitize(t *testing.T) {
+	conn, lines := newServerConn(t)
+	config := &Config{}
+
+	sendMessage(conn, "#go", "hi\r\nQUIT :bye")
+	sendNotice(conn, "alice", "one\ntwo")
+	sendMessageToAll(conn, []string{"#go", "#rust"}, "a\x00b")
+	sendReply(config, conn, "#go", "title\r\nwith\tbreaks")
+	// Nothing is left to send of these
+	sendMessage(conn, "#go", "\r\n")
+	sendNotice(conn, "alice", "\t")
+	sendMessageToAll(conn, []string{"#go"}, " ")
+	sendReply(config, conn, "#go", "\n")
+
+	want := []string{
+		"PRIVMSG #go :hi QUIT :bye",
+		"NOTICE alice :one two",
+		"PRIVMSG #go :ab",
+		"PRIVMSG #rust :ab",
+		"PRIVMSG #go :title with breaks",
+	}
+	if got := sentLines(t, conn, lines); !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestReplyLimitersExpire(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	previous := defaultClock
+	defaultClock = clock
+	t.Cleanup(func() { defaultClock = previous })
+
+	conn := irc.IRC("gobot", "gobot")
+	config := &Config{Security: SecurityConfig{RateLimit: RateLimitConfig{Enabled: true, Rate: 1, Burst: 1}}}
+
+	if !allowReply(config, conn, "#go") || allowReply(config, conn, "#GO") {
+		t.Fatal("allowReply() didn't limit replies to the burst")
+	}
+	if !allowReply(config, conn, "#rust") {
+		t.Error("allowReply() limited another target")
+	}
+
+	clock.advance(time.Second)
+	if !allowReply(config, conn, "#zig") {
+		t.Fatal("allowReply() limited a new target")
+	}
+	replyLimitersMutex.Lock()
+	targets := slices.Collect(maps.Keys(replyLimiters[conn]))
+	replyLimitersMutex.Unlock()
+	if !slices.Equal(targets, []string{"#zig"}) {
+		t.Errorf("limiters are kept for %q, want only #zig", targets)
+	}
+
+	publish(EventClosed, config, conn, nil)
+	replyLimitersMutex.Lock()
+	_, ok := replyLimiters[conn]
+	replyLimitersMutex.Unlock()
+	if ok {
+		t.Error("limiters are kept after the connection closed")
+	}
+}
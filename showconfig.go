@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	irc "github.com/thoj/go-ircevent"
+	"gopkg.in/yaml.v2"
+)
+
+// redacted replaces secret values in the configuration dump
+const redacted = "[REDACTED]"
+
+func init() {
+	registerAdminCommand("config", configCommand)
+}
+
+// isSecretKey reports whether a configuration key holds a secret. Paths to secret files are not secrets themselves.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "file") {
+		return false
+	}
+	for _, word := range []string{"key", "password", "secret", "token"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpConfig returns the settings that differ from their zero value as sorted "path: value" lines,
+// with the secrets and custom header values redacted.
+func dumpConfig(config *Config) ([]string, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree yaml.MapSlice
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	flattenConfig("", tree, false, &lines)
+	sort.Strings(lines)
+	return lines, nil
+}
+
+// flattenConfig appends the leaves of a decoded configuration tree to lines, redacting secret ones.
+func flattenConfig(path string, value any, secret bool, lines *[]string) {
+	join := func(key any) string {
+		if path == "" {
+			return fmt.Sprint(key)
+		}
+		return path + "." + fmt.Sprint(key)
+	}
+
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			// Header values are often credentials too
+			flattenConfig(join(item.Key), item.Value, secret || isSecretKey(fmt.Sprint(item.Key)) || strings.EqualFold(fmt.Sprint(item.Key), "headers"), lines)
+		}
+	case []any:
+		if len(v) == 0 {
+			return
+		}
+		if secret {
+			*lines = append(*lines, path+": "+redacted)
+			return
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		*lines = append(*lines, path+": "+strings.Join(items, ", "))
+	case nil:
+	default:
+		// Unset settings are left out, durations are marshaled as strings
+		if v == "" || v == 0 || v == false || v == "0s" {
+			return
+		}
+		if secret {
+			v = redacted
+		}
+		*lines = append(*lines, fmt.Sprintf("%s: %v", path, v))
+	}
+}
+
+// configCommand handles ".config" by sending the loaded configuration, secrets redacted, to the user in private.
+func configCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	lines, err := dumpConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("error dumping configuration: %w", err)
+	}
+	// The dump is dozens of lines, sending them all at once would get the bot disconnected for flooding
+	go sendPaced(conn, e.Nick, lines, pacedMessageDelay)
+	if isPrivate(conn, e) {
+		return "", nil
+	}
+	return "Sent the configuration in private", nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsSecretKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "apiKey", want: true},
+		{key: "nickServPassword", want: true},
+		{key: "clientSecret", want: true},
+		{key: "Token", want: true},
+		{key: "apiKeyFile", want: false},
+		{key: "passwordFile", want: false},
+		{key: "endpoint", want: false},
+		{key: "nickname", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := isSecretKey(tt.key); got != tt.want {
+				t.Errorf("isSecretKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpConfig(t *testing.T) {
+	config := &Config{
+		Nickname: "gobot",
+		Networks: map[string]Network{
+			"libera": {
+				Server:           "irc.libera.chat",
+				Channels:         []string{"#a", "#b"},
+				NickServ:         "NickServ",
+				NickServPassword: "hunter2",
+			},
+		},
+		TitleBackend: TitleConfig{APIConfig: APIConfig{
+			Endpoint:   "https://example.com/title",
+			APIKey:     "abc123",
+			APIKeyFile: "/run/secrets/title",
+			Headers:    map[string]string{"X-Auth": "s3cret"},
+			Timeout:    Duration(5 * time.Second),
+		}},
+	}
+
+	lines, err := dumpConfig(config)
+	if err != nil {
+		t.Fatalf("dumpConfig() error = %v", err)
+	}
+
+	want := []string{
+		"networks.libera.channels: #a, #b",
+		"networks.libera.nickServ: NickServ",
+		"networks.libera.nickServPassword: " + redacted,
+		"networks.libera.server: irc.libera.chat",
+		"nickname: gobot",
+		"titlebackend.apiKey: " + redacted,
+		"titlebackend.apiKeyFile: /run/secrets/title",
+		"titlebackend.endpoint: https://example.com/title",
+		"titlebackend.headers.X-Auth: " + redacted,
+		"titlebackend.timeout: 5s",
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("dumpConfig() =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	for _, line := range lines {
+		for _, secret := range []string{"hunter2", "abc123", "s3cret"} {
+			if strings.Contains(line, secret) {
+				t.Errorf("dumpConfig() leaked %q in %q", secret, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// channelCounts is the message throughput of a single channel.
+type channelCounts struct {
+	Received int
+	Sent     int
+}
+
+// throughput counts the messages received from and sent to each channel since the bot started.
+type throughput struct {
+	sync.Mutex
+	// "network channel" -> counts
+	counts map[string]*channelCounts
+}
+
+var messageStats = &throughput{counts: make(map[string]*channelCounts)}
+
+func init() {
+	registerCommand("stats", statsCommand)
+}
+
+// statsKey returns the key a channel is counted under, only channels are counted so private messages don't pile up.
+func statsKey(conn *irc.Connection, target string) (string, bool) {
+	if target == "" || !strings.ContainsRune(chanTypes(conn), rune(target[0])) {
+		return "", false
+	}
+	return connections.name(conn) + " " + strings.ToLower(target), true
+}
+
+// channel returns the counts of a channel, creating them if needed. The caller must hold the lock.
+func (t *throughput) channel(key string) *channelCounts {
+	counts, ok := t.counts[key]
+	if !ok {
+		counts = &channelCounts{}
+		t.counts[key] = counts
+	}
+	return counts
+}
+
+// received counts a message received on a channel.
+func (t *throughput) received(conn *irc.Connection, channel string) {
+	key, ok := statsKey(conn, channel)
+	if !ok {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.channel(key).Received++
+}
+
+// sent counts lines sent to a channel.
+func (t *throughput) sent(conn *irc.Connection, channel string, lines int) {
+	key, ok := statsKey(conn, channel)
+	if !ok {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.channel(key).Sent += lines
+}
+
+// get returns the counts of a channel.
+func (t *throughput) get(conn *irc.Connection, channel string) channelCounts {
+	key, _ := statsKey(conn, channel)
+	t.Lock()
+	defer t.Unlock()
+	if counts, ok := t.counts[key]; ok {
+		return *counts
+	}
+	return channelCounts{}
+}
+
+// busiest returns the channels of a network ordered by the number of messages received.
+func (t *throughput) busiest(conn *irc.Connection) []string {
+	prefix := connections.name(conn) + " "
+	t.Lock()
+	defer t.Unlock()
+
+	var channels []string
+	for key := range t.counts {
+		if strings.HasPrefix(key, prefix) {
+			channels = append(channels, strings.TrimPrefix(key, prefix))
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		a, b := t.counts[prefix+channels[i]], t.counts[prefix+channels[j]]
+		if a.Received != b.Received {
+			return a.Received > b.Received
+		}
+		return channels[i] < channels[j]
+	})
+	return channels
+}
+
+// statsCommand handles ".stats [#channel]", reporting messages received and sent since the bot started.
+func statsCommand(config *Config, conn *irc.Connection, e *irc.Event, args []string) (string, error) {
+	since := fmt.Sprintf("in %s", formatUptime(time.Since(startTime)))
+
+	if len(args) > 0 {
+		channel := normalizeChannel(conn, args[0])
+		counts := messageStats.get(conn, channel)
+		return fmt.Sprintf("%s: %d received, %d sent %s", channel, counts.Received, counts.Sent, since), nil
+	}
+
+	channels := messageStats.busiest(conn)
+	if len(channels) == 0 {
+		return "No messages yet", nil
+	}
+	var parts []string
+	for _, channel := range channels {
+		counts := messageStats.get(conn, channel)
+		parts = append(parts, fmt.Sprintf("%s %d/%d", channel, counts.Received, counts.Sent))
+	}
+	return fmt.Sprintf("Received/sent %s: %s", since, strings.Join(parts, ", ")), nil
+}
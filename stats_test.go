@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+func TestThroughput(t *testing.T) {
+	libera := newNetworkConn(t)
+	oftc := irc.IRC("gobot", "gobot")
+	connections.add("oftc", oftc, slog.Default())
+	t.Cleanup(func() { connections.remove(oftc) })
+
+	stats := &throughput{counts: make(map[string]*channelCounts)}
+	stats.received(libera, "#go")
+	stats.received(libera, "#Go")
+	stats.received(libera, "#rust")
+	stats.sent(libera, "#go", 3)
+	stats.received(oftc, "#go")
+	// Private messages aren't counted
+	stats.received(libera, "alice")
+	stats.sent(libera, "alice", 1)
+	stats.received(libera, "")
+
+	tests := []struct {
+		name    string
+		conn    *irc.Connection
+		channel string
+		want    channelCounts
+	}{
+		{name: "busy channel", conn: libera, channel: "#go", want: channelCounts{Received: 2, Sent: 3}},
+		{name: "other case", conn: libera, channel: "#GO", want: channelCounts{Received: 2, Sent: 3}},
+		{name: "quiet channel", conn: libera, channel: "#rust", want: channelCounts{Received: 1}},
+		{name: "other network", conn: oftc, channel: "#go", want: channelCounts{Received: 1}},
+		{name: "unknown channel", conn: libera, channel: "#none", want: channelCounts{}},
+		{name: "private", conn: libera, channel: "alice", want: channelCounts{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stats.get(tt.conn, tt.channel); got != tt.want {
+				t.Errorf("get(%q) = %+v, want %+v", tt.channel, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := stats.busiest(libera), []string{"#go", "#rust"}; !slices.Equal(got, want) {
+		t.Errorf("busiest() = %q, want %q", got, want)
+	}
+	if got, want := stats.busiest(oftc), []string{"#go"}; !slices.Equal(got, want) {
+		t.Errorf("busiest() on the other network = %q, want %q", got, want)
+	}
+}
+
+func TestStatsKey(t *testing.T) {
+	conn := newNetworkConn(t)
+
+	tests := []struct {
+		target string
+		want   string
+		wantOK bool
+	}{
+		{target: "#Go", want: "libera #go", wantOK: true},
+		{target: "&local", want: "libera &local", wantOK: true},
+		{target: "alice", wantOK: false},
+		{target: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			key, ok := statsKey(conn, tt.target)
+			if key != tt.want || ok != tt.wantOK {
+				t.Errorf("statsKey(%q) = %q, %v, want %q, %v", tt.target, key, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// dataPath returns the path of a persisted data file inside the configured data directory.
+func dataPath(config *Config, name string) string {
+	dir := config.DataDir
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, name)
+}
+
+// loadJSON reads a persisted JSON file into v. A missing file is not an error.
+func loadJSON(config *Config, name string, v any) error {
+	data, err := os.ReadFile(dataPath(config, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// saveJSON writes v as JSON into the data directory, replacing the previous file atomically.
+func saveJSON(config *Config, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := dataPath(config, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// defaultNetworkRestartDelay is how long to wait before starting a stopped network again by default
+	defaultNetworkRestartDelay = time.Minute
+	// defaultMaxNetworkRestarts is how many times a stopped network is started again by default
+	defaultMaxNetworkRestarts = 5
+)
+
+// superviseNetwork runs a network and starts it again after a delay whenever it stops
+// before ctx is cancelled, e.g. because connecting gave up, until the restarts run out.
+// run calls connected once the network is up, which starts the restart count over.
+func superviseNetwork(ctx context.Context, config *Config, name string, run func(ctx context.Context, connected func()) error) {
+	delay := time.Duration(config.NetworkRestartDelay)
+	if delay <= 0 {
+		delay = defaultNetworkRestartDelay
+	}
+	maxRestarts := config.MaxNetworkRestarts
+	if maxRestarts == 0 {
+		maxRestarts = defaultMaxNetworkRestarts
+	}
+
+	restarts := 0
+	for {
+		err := runRecovered(ctx, name, func() { restarts = 0 }, run)
+		if ctx.Err() != nil {
+			return
+		}
+		if maxRestarts < 0 || restarts >= maxRestarts {
+			slog.Error("Network stopped, giving up", "network", name, "restarts", restarts, "error", err)
+			return
+		}
+
+		restarts++
+		slog.Warn("Network stopped, restarting", "network", name, "restart", restarts, "restartIn", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-defaultClock.After(delay):
+		}
+	}
+}
+
+// runRecovered calls run, turning a panic into an error so one broken network doesn't take the bot down.
+func runRecovered(ctx context.Context, name string, connected func(), run func(ctx context.Context, connected func()) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Network panicked", "network", name, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx, connected)
+}
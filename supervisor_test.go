@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// instantClock fires every timer immediately and records the requested delays.
+type instantClock struct {
+	delays []time.Duration
+}
+
+func (c *instantClock) Now() time.Time { return time.Now() }
+
+func (c *instantClock) After(d time.Duration) <-chan time.Time {
+	c.delays = append(c.delays, d)
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return ch
+}
+
+func (c *instantClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.delays = append(c.delays, d)
+	return time.AfterFunc(0, f)
+}
+
+func useInstantClock(t *testing.T) *instantClock {
+	t.Helper()
+	clock := &instantClock{}
+	previous := defaultClock
+	defaultClock = clock
+	t.Cleanup(func() { defaultClock = previous })
+	return clock
+}
+
+func TestSuperviseNetwork(t *testing.T) {
+	errStopped := errors.New("stopped")
+
+	tests := []struct {
+		name     string
+		config   Config
+		run      func(call int, connected func()) error
+		wantRuns int
+	}{
+		{
+			name:     "gives up after the restarts",
+			config:   Config{MaxNetworkRestarts: 2},
+			run:      func(call int, connected func()) error { return errStopped },
+			wantRuns: 3,
+		},
+		{
+			name:     "default restarts",
+			run:      func(call int, connected func()) error { return errStopped },
+			wantRuns: defaultMaxNetworkRestarts + 1,
+		},
+		{
+			name:     "never restarts",
+			config:   Config{MaxNetworkRestarts: -1},
+			run:      func(call int, connected func()) error { return errStopped },
+			wantRuns: 1,
+		},
+		{
+			name:   "connecting starts the count over",
+			config: Config{MaxNetworkRestarts: 2},
+			run: func(call int, connected func()) error {
+				// The third run gets connected, so two more restarts are allowed after it
+				if call == 3 {
+					connected()
+				}
+				return errStopped
+			},
+			wantRuns: 5,
+		},
+		{
+			name:   "panics are restarted",
+			config: Config{MaxNetworkRestarts: 1},
+			run: func(call int, connected func()) error {
+				panic("broken")
+			},
+			wantRuns: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := useInstantClock(t)
+			runs := 0
+			superviseNetwork(context.Background(), &tt.config, "test", func(ctx context.Context, connected func()) error {
+				runs++
+				return tt.run(runs, connected)
+			})
+			if runs != tt.wantRuns {
+				t.Errorf("runs = %d, want %d", runs, tt.wantRuns)
+			}
+			for _, delay := range clock.delays {
+				if delay != defaultNetworkRestartDelay {
+					t.Errorf("restart delay = %v, want %v", delay, defaultNetworkRestartDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestSuperviseNetworkCancelled(t *testing.T) {
+	useInstantClock(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runs := 0
+	superviseNetwork(ctx, &Config{}, "test", func(ctx context.Context, connected func()) error {
+		runs++
+		cancel()
+		return nil
+	})
+	if runs != 1 {
+		t.Errorf("runs = %d, want 1", runs)
+	}
+}
+
+func TestRunRecovered(t *testing.T) {
+	err := runRecovered(context.Background(), "test", func() {}, func(ctx context.Context, connected func()) error {
+		panic("broken")
+	})
+	if err == nil || err.Error() != "panic: broken" {
+		t.Errorf("runRecovered() error = %v, want panic: broken", err)
+	}
+}
+
+func TestEventClosedForgetsConnection(t *testing.T) {
+	conn := irc.IRC("gobot", "gobot")
+	connections.add("test", conn, slog.Default())
+	currentNicks.set(conn, "gobot_")
+	connectedAt.set(conn, time.Now())
+	maxMessageLengthsMutex.Lock()
+	maxMessageLengths[conn] = 100
+	maxMessageLengthsMutex.Unlock()
+
+	publish(EventClosed, &Config{}, conn, nil)
+	connections.remove(conn)
+
+	if _, ok := connections.get("test"); ok {
+		t.Error("connection is still registered")
+	}
+	if name := connections.name(conn); name != "" {
+		t.Errorf("connections.name() = %q, want empty", name)
+	}
+	if nick := currentNicks.get(conn); nick != "" {
+		t.Errorf("currentNicks.get() = %q, want empty", nick)
+	}
+	if !connectedAt.get(conn).IsZero() {
+		t.Error("connect time is still recorded")
+	}
+	maxMessageLengthsMutex.Lock()
+	_, ok := maxMessageLengths[conn]
+	maxMessageLengthsMutex.Unlock()
+	if ok {
+		t.Error("message length limit is still recorded")
+	}
+}
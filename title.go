@@ -1,12 +1,17 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
-	"io"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	irc "github.com/thoj/go-ircevent"
 )
@@ -22,59 +27,428 @@ type TitleResponse struct {
 	ErrorMessage string `json:"errorMessage"`
 }
 
-// fetchLambdaTitle fetches the title using a Lambda function.
-func fetchLambdaTitle(config *Config, payload *TitlePayload) (string, error) {
-	data, err := json.Marshal(payload)
+const (
+	// defaultBatchSize is the number of titles combined per line when batching is on
+	defaultBatchSize = 3
+	// defaultDedupWindow is how long a URL announced in a channel is not looked up again by default
+	defaultDedupWindow = time.Minute
+	// defaultTitleCacheTTL and defaultTitleCacheSize are the title cache settings by default
+	defaultTitleCacheTTL  = 10 * time.Minute
+	defaultTitleCacheSize = 1000
+)
+
+// batchKey identifies a channel on a connection.
+type batchKey struct {
+	conn    *irc.Connection
+	channel string
+}
+
+// titleBatcher collects titles announced in quick succession so they can be sent as fewer lines.
+type titleBatcher struct {
+	sync.Mutex
+	clock   Clock
+	pending map[batchKey][]string
+}
+
+var titleBatches = &titleBatcher{clock: defaultClock, pending: make(map[batchKey][]string)}
+
+// userTitles limits how many titles a single user can trigger per minute
+var userTitles = newWindowLimiter(time.Minute)
+
+// titleCache holds the titles of recently looked up URLs for every channel
+var titleCache = newTTLCache()
+
+func init() {
+	registerFeature("title", func(config *Config, conn *irc.Connection) {
+		size := config.TitleBackend.CacheMaxEntries
+		if size <= 0 {
+			size = defaultTitleCacheSize
+		}
+		titleCache.setMaxEntries(size)
+	})
+	subscribe(EventClosed, func(config *Config, conn *irc.Connection, e *irc.Event) {
+		userTitles.forget(connections.name(conn) + " ")
+	})
+}
+
+// titleCacheTTL returns how long titles are cached, zero if caching is off.
+func titleCacheTTL(config *Config) time.Duration {
+	ttl := time.Duration(config.TitleBackend.CacheTTL)
+	if ttl == 0 {
+		return defaultTitleCacheTTL
+	}
+	return max(ttl, 0)
+}
+
+// recentURLs holds the URLs recently announced per channel, keyed by network, channel and URL
+var recentURLs = newTTLCache()
+
+// dedupWindow returns how long announced URLs are remembered, zero if deduplication is off.
+func dedupWindow(config *Config) time.Duration {
+	window := time.Duration(config.TitleBackend.DedupWindow)
+	if window == 0 {
+		return defaultDedupWindow
+	}
+	return max(window, 0)
+}
+
+// recentURLKey returns the key a URL announced on a channel is remembered under.
+func recentURLKey(conn *irc.Connection, channel, urlStr string) string {
+	return connections.name(conn) + " " + strings.ToLower(channel) + " " + urlStr
+}
+
+// add queues a title for the channel, the first title of a batch schedules the flush.
+func (b *titleBatcher) add(config *Config, conn *irc.Connection, channel, title string) {
+	b.Lock()
+	defer b.Unlock()
+
+	key := batchKey{conn: conn, channel: channel}
+	if len(b.pending[key]) == 0 {
+		b.clock.AfterFunc(time.Duration(config.TitleBackend.BatchWindow), func() {
+			b.flush(config, key)
+		})
+	}
+	b.pending[key] = append(b.pending[key], title)
+}
+
+// flush sends the pending titles of a channel, combining up to BatchSize titles per line.
+func (b *titleBatcher) flush(config *Config, key batchKey) {
+	b.Lock()
+	titles := b.pending[key]
+	delete(b.pending, key)
+	b.Unlock()
+
+	for _, line := range combineTitles(titles, config.TitleBackend.BatchSize) {
+		sendTitle(config, key.conn, key.channel, line)
+	}
+}
+
+// combineTitles joins formatted titles into reply lines holding at most size titles each.
+func combineTitles(titles []string, size int) []string {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	var lines []string
+	for start := 0; start < len(titles); start += size {
+		end := min(start+size, len(titles))
+		lines = append(lines, strings.Join(titles[start:end], " | "))
+	}
+	return lines
+}
+
+// maxQueuedTitles is how many title replies can wait for the channel throttle before new ones are dropped
+const maxQueuedTitles = 5
+
+// titleThrottle spaces out title replies in a channel.
+type titleThrottle struct {
+	sync.Mutex
+	clock Clock
+	// when the next title can be sent in a channel
+	next map[batchKey]time.Time
+}
+
+var channelTitles = &titleThrottle{clock: defaultClock, next: make(map[batchKey]time.Time)}
+
+// schedule reserves the next free slot in the channel and returns how long to wait for it.
+// It returns false if the queue for the channel is already full.
+func (t *titleThrottle) schedule(key batchKey, interval time.Duration) (time.Duration, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.clock.Now()
+	slot := t.next[key]
+	if slot.Before(now) {
+		slot = now
+	}
+	delay := slot.Sub(now)
+	if delay > interval*maxQueuedTitles {
+		return 0, false
+	}
+	t.next[key] = slot.Add(interval)
+	return delay, true
+}
+
+// sendTitle sends a title line to the channel, respecting the per-channel interval.
+func sendTitle(config *Config, conn *irc.Connection, channel, line string) {
+	interval := time.Duration(config.TitleBackend.ChannelInterval)
+	if interval <= 0 {
+		sendReply(config, conn, channel, line)
+		return
+	}
+
+	delay, ok := channelTitles.schedule(batchKey{conn: conn, channel: channel}, interval)
+	if !ok {
+		slog.Warn("Too many titles queued, dropping", "channel", channel, "line", line)
+		return
+	}
+	channelTitles.clock.AfterFunc(delay, func() {
+		sendReply(config, conn, channel, line)
+	})
+}
+
+// defaultTitleFormat is how titles are announced unless the channel or the title backend has another template
+const defaultTitleFormat = "Title: {title}"
+
+// titleFormat returns the title template of a channel, falling back to the global one.
+func titleFormat(config *Config, conn *irc.Connection, channel string) string {
+	network := config.Networks[connections.name(conn)]
+	for name, format := range network.TitleFormats {
+		if strings.EqualFold(normalizeChannel(conn, name), channel) && format != "" {
+			return format
+		}
+	}
+	if config.TitleBackend.Format != "" {
+		return config.TitleBackend.Format
+	}
+	return defaultTitleFormat
+}
+
+// formatTitle expands {title}, {url} and {host} in a title template.
+func formatTitle(format, title, urlStr string) string {
+	host := ""
+	if u, err := url.Parse(urlStr); err == nil {
+		host = u.Hostname()
+	}
+	return strings.NewReplacer("{title}", title, "{url}", urlStr, "{host}", host).Replace(format)
+}
+
+// announceTitle sends a formatted title to the channel, batching it with others if configured.
+func announceTitle(config *Config, conn *irc.Connection, channel, title string) {
+	if config.TitleBackend.BatchWindow <= 0 {
+		sendTitle(config, conn, channel, title)
+		return
+	}
+	titleBatches.add(config, conn, channel, title)
+}
+
+// fetchTitle fetches the title from the title backend, trying the failover endpoints in order if a request fails.
+// An error message from a backend that answered is final.
+func fetchTitle(config *Config, logger *slog.Logger, payload *TitlePayload) (string, error) {
+	endpoints := append([]string{config.TitleBackend.Endpoint}, config.TitleBackend.FailoverEndpoints...)
+
+	var response TitleResponse
+	var err error
+	for i, endpoint := range endpoints {
+		api := config.TitleBackend.APIConfig
+		api.Endpoint = endpoint
+		if err = callAPI(api, payload, &response); err == nil {
+			break
+		}
+		if i < len(endpoints)-1 {
+			logger.Warn("Title backend failed, trying the next one", "endpoint", redactSecrets(api, endpoint), "error", err)
+		}
+	}
 	if err != nil {
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", config.LambdaTitle.Endpoint, bytes.NewBuffer(data))
+	if response.ErrorMessage != "" {
+		return "", errors.New(response.ErrorMessage)
+	}
+
+	return response.Title, nil
+}
+
+// stripUserinfo returns the URL without any user:password part, so credentials never end up in logs or the title backend.
+func stripUserinfo(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	return clean.String()
+}
+
+// hostMatches reports whether the host of a URL is one of the domains or a subdomain of one.
+// Matching is case-insensitive and ignores the port.
+func hostMatches(u *url.URL, domains []string) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxShortenerHops is how many redirects between shorteners are followed
+const maxShortenerHops = 10
+
+// shortenerConfigKey is the request context key of the configuration shortener redirects are checked against
+type shortenerConfigKey struct{}
+
+// shortenerClient expands short links over the shared transport. Redirects are only followed
+// to other shorteners on allowed ports, the first hop anywhere else is read from the Location header
+// instead of requested, so a short link can't make the bot request internal addresses.
+var shortenerClient = &http.Client{
+	Transport: apiClient.Transport,
+	Timeout:   5 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		config, _ := req.Context().Value(shortenerConfigKey{}).(*Config)
+		if config == nil || len(via) >= maxShortenerHops ||
+			!hostMatches(req.URL, config.TitleBackend.Shorteners) || !portAllowed(config, req.URL) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// unshorten follows the redirects of a known URL shortener and returns the URL it points to.
+func unshorten(config *Config, urlStr string) (string, error) {
+	ctx := context.WithValue(context.Background(), shortenerConfigKey{}, config)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, urlStr, nil)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", config.LambdaTitle.APIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := shortenerClient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	expanded := resp.Request.URL
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location, err := resp.Location(); err == nil {
+			expanded = location
+		}
+	}
+	return stripUserinfo(expanded), nil
+}
+
+// defaultAllowedPorts are the ports titles are looked up for by default
+var defaultAllowedPorts = []int{80, 443}
+
+// portAllowed reports whether the port of the URL is allowed, URLs without an explicit port always are.
+func portAllowed(config *Config, u *url.URL) bool {
+	if u.Port() == "" {
+		return true
+	}
+	port, err := strconv.Atoi(u.Port())
 	if err != nil {
-		return "", err
+		return false
 	}
+	allowed := config.TitleBackend.AllowedPorts
+	if len(allowed) == 0 {
+		allowed = defaultAllowedPorts
+	}
+	return slices.Contains(allowed, port)
+}
 
-	var response TitleResponse
-	err = json.Unmarshal(body, &response)
+// isIgnoredURL reports whether the URL is on one of the ignored domains or has a port that isn't allowed.
+func isIgnoredURL(config *Config, logger *slog.Logger, urlStr string) bool {
+	u, err := url.Parse(urlStr)
 	if err != nil {
-		return "", err
+		return false
+	}
+	if hostMatches(u, config.TitleBackend.IgnoredDomains) {
+		logger.Debug("Ignored domain, not looking up title", "url", urlStr)
+		return true
 	}
+	if !portAllowed(config, u) {
+		logger.Debug("Port not allowed, not looking up title", "url", urlStr)
+		return true
+	}
+	return false
+}
 
-	if response.ErrorMessage != "" {
-		return "", errors.New(response.ErrorMessage)
+// handleURLs looks up the titles of the URLs of one message and announces them in the order they were posted,
+// combined into one line when there are several.
+func handleURLs(config *Config, conn *irc.Connection, logger *slog.Logger, e *irc.Event, urls []string) {
+	titles := make([]string, len(urls))
+	var wg sync.WaitGroup
+	for i, urlStr := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			titles[i], _ = resolveTitle(config, conn, logger, e, urlStr)
+		}()
 	}
+	wg.Wait()
 
-	return response.Title, nil
+	channel := replyTarget(conn, e)
+	format := titleFormat(config, conn, channel)
+	var found []string
+	for i, title := range titles {
+		if title != "" {
+			found = append(found, formatTitle(format, title, urls[i]))
+		}
+	}
+	if len(found) > 0 {
+		announceTitle(config, conn, channel, strings.Join(found, " | "))
+	}
 }
 
-// handleURL handles the URL received in the IRC event.
-func handleURL(config *Config, conn *irc.Connection, e *irc.Event, urlStr string) {
-	payload := &TitlePayload{
-		URL:     urlStr,
-		Channel: e.Arguments[0],
-		User:    e.Source,
+// resolveTitle returns the title to announce for a URL received in the IRC event,
+// or false if there is nothing to announce.
+func resolveTitle(config *Config, conn *irc.Connection, logger *slog.Logger, e *irc.Event, urlStr string) (string, bool) {
+	if isIgnoredURL(config, logger, urlStr) {
+		return "", false
 	}
 
-	title, err := fetchLambdaTitle(config, payload)
-	if err != nil {
-		log.Printf("Error fetching Lambda title: %s", err)
-		return
+	// Only expand links from known shorteners, everything else goes to the backend as is
+	if u, err := url.Parse(urlStr); err == nil && hostMatches(u, config.TitleBackend.Shorteners) {
+		expanded, err := unshorten(config, urlStr)
+		if err != nil {
+			logger.Warn("Error expanding short URL", "url", urlStr, "error", err)
+		} else {
+			logger.Info("Expanded short URL", "url", urlStr, "expanded", expanded)
+			urlStr = expanded
+		}
+		// The short link can point anywhere
+		if isIgnoredURL(config, logger, urlStr) {
+			return "", false
+		}
 	}
-	if title != "" {
-		conn.Privmsg(e.Arguments[0], "Title: "+title)
+
+	channel := replyTarget(conn, e)
+	window := dedupWindow(config)
+	if _, seen := recentURLs.get(recentURLKey(conn, channel, urlStr)); seen && window > 0 {
+		logger.Info("URL announced recently, skipping", "channel", channel, "url", urlStr)
+		return "", false
+	}
+
+	title, cached := titleCache.get(urlStr)
+	if cached {
+		logger.Debug("Title cache hit", "url", urlStr)
+	} else {
+		logger.Debug("Title cache miss", "url", urlStr)
+
+		payload := &TitlePayload{
+			URL:     urlStr,
+			Channel: e.Arguments[0],
+			User:    e.Source,
+		}
+
+		var err error
+		title, err = fetchTitle(config, logger, payload)
+		if errors.Is(err, errAPITimeout) {
+			logger.Warn("Title backend timed out", "url", urlStr, "error", err)
+			return "", false
+		}
+		if err != nil {
+			logger.Error("Error fetching title", "error", err)
+			return "", false
+		}
+		if title == "" {
+			return "", false
+		}
+		if ttl := titleCacheTTL(config); ttl > 0 {
+			titleCache.set(urlStr, title, ttl)
+		}
+	}
+
+	if limit := config.TitleBackend.MaxPerUser; limit > 0 {
+		// Nicks are only unique within a network
+		allowed, warn := userTitles.allow(connections.name(conn)+" "+strings.ToLower(e.Nick), limit)
+		if !allowed {
+			logger.Info("Title limit reached, not announcing", "nick", e.Nick, "url", urlStr)
+			if warn {
+				sendNotice(conn, e.Nick, fmt.Sprintf("You have reached the limit of %d titles per minute, slow down", limit))
+			}
+			return "", false
+		}
+	}
+
+	if window > 0 {
+		recentURLs.set(recentURLKey(conn, channel, urlStr), title, window)
 	}
+	return title, true
 }